@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// collectAssetGarbage deletes stored videos that no job in VIDEO_JOB_DIR
+// refers to. Assets younger than ASSET_GC_GRACE_HOURS (default 24) are
+// kept, since a running generation may not have recorded them yet.
+func collectAssetGarbage(dryRun bool) {
+	ctx := context.Background()
+
+	store, err := NewAssetStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid asset store config: %v", err)
+	}
+	if store == nil {
+		log.Fatalf("ASSET_STORE must name the asset store to clean up")
+	}
+
+	// Without the jobs every asset looks unreferenced.
+	jobDir := os.Getenv("VIDEO_JOB_DIR")
+	if jobDir == "" {
+		log.Fatalf("VIDEO_JOB_DIR must point at the video jobs that reference assets")
+	}
+	jobs, err := OpenVideoJobQueue(jobDir)
+	if err != nil {
+		log.Fatalf("Failed to open video job queue: %v", err)
+	}
+
+	grace, err := strconv.Atoi(getEnvWithDefault("ASSET_GC_GRACE_HOURS", "24"))
+	if err != nil || grace < 0 {
+		log.Fatalf("ASSET_GC_GRACE_HOURS must be a non-negative integer")
+	}
+
+	referenced := jobs.Assets()
+	removed, err := store.GC(ctx, referenced, time.Now().Add(-time.Duration(grace)*time.Hour), dryRun)
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	for _, sha := range removed {
+		fmt.Printf("%s %s\n", verb, sha)
+	}
+	if err != nil {
+		log.Fatalf("Asset garbage collection failed: %v", err)
+	}
+	fmt.Printf("🧹 %s %d unreferenced assets from %s, %d referenced by jobs\n", verb, len(removed), store, len(referenced))
+}
+
+func init() {
+	// go run ... asset-gc [--dry-run] deletes assets no video job uses
+	if len(os.Args) > 1 && os.Args[1] == "asset-gc" {
+		collectAssetGarbage(len(os.Args) > 2 && os.Args[2] == "--dry-run")
+		os.Exit(0)
+	}
+}
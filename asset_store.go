@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrAssetNotFound = errors.New("asset not found")
+
+// AssetBackend stores opaque objects under slash-separated keys.
+type AssetBackend interface {
+	// Put stores body under key, replacing any existing object.
+	Put(ctx context.Context, key string, body io.ReadSeeker) error
+	// Get fails with ErrAssetNotFound when there is no object under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, prefix string) ([]AssetObject, error)
+	// String describes where objects are stored, for logs.
+	String() string
+}
+
+type AssetObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// AssetMetadata is stored as a JSON sidecar next to each asset.
+type AssetMetadata struct {
+	SHA256      string        `json:"sha256"`
+	Size        int64         `json:"size"`
+	ContentType string        `json:"content_type"`
+	VideoID     string        `json:"video_id,omitempty"`
+	PromptID    string        `json:"prompt_id,omitempty"`
+	Provider    VideoProvider `json:"provider,omitempty"`
+	SourceURL   string        `json:"source_url,omitempty"`
+	// Parent is the asset a post-processed version was made from, for the
+	// Account it was made for by Steps.
+	Parent    string    `json:"parent,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	Steps     []string  `json:"steps,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AssetStore keeps finished videos keyed by the SHA-256 of their content,
+// so provider URLs can expire without losing the video and identical
+// downloads are stored once.
+type AssetStore struct {
+	backend   AssetBackend
+	publicURL string
+}
+
+const assetPrefix = "videos/"
+
+func NewAssetStore(backend AssetBackend) *AssetStore {
+	return &AssetStore{backend: backend}
+}
+
+// NewAssetStoreFromEnv builds the store ASSET_STORE names: "local" under
+// ASSET_STORE_DIR, or "s3" (see NewS3AssetBackendFromEnv). It returns nil
+// when ASSET_STORE is unset.
+func NewAssetStoreFromEnv() (*AssetStore, error) {
+	var backend AssetBackend
+	switch kind := os.Getenv("ASSET_STORE"); kind {
+	case "":
+		return nil, nil
+	case "local":
+		dir := os.Getenv("ASSET_STORE_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("ASSET_STORE_DIR is required for the local asset store")
+		}
+		local, err := NewLocalAssetBackend(dir)
+		if err != nil {
+			return nil, err
+		}
+		backend = local
+	case "s3":
+		s3, err := NewS3AssetBackendFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		backend = s3
+	default:
+		return nil, fmt.Errorf("ASSET_STORE must be local or s3, got %q", kind)
+	}
+
+	store := NewAssetStore(backend)
+	store.SetPublicURL(os.Getenv("ASSET_PUBLIC_URL"))
+	return store, nil
+}
+
+func (s *AssetStore) String() string {
+	return s.backend.String()
+}
+
+// SetPublicURL sets where the store's objects can be downloaded by anyone,
+// such as a public bucket or a CDN in front of it. Object keys are
+// appended to it.
+func (s *AssetStore) SetPublicURL(base string) {
+	s.publicURL = strings.TrimSuffix(base, "/")
+}
+
+func (s *AssetStore) PublicURL() string {
+	return s.publicURL
+}
+
+// URL returns the public URL of an asset, or "" without a public URL.
+func (s *AssetStore) URL(sha string) string {
+	if s.publicURL == "" {
+		return ""
+	}
+	return s.publicURL + "/" + assetKey(sha)
+}
+
+func assetKey(sha string) string {
+	return assetPrefix + sha[:2] + "/" + sha + ".mp4"
+}
+
+func assetMetadataKey(sha string) string {
+	return assetPrefix + sha[:2] + "/" + sha + ".json"
+}
+
+// Put stores the content of body and its metadata sidecar and returns the
+// completed metadata. Content that is already stored keeps its original
+// sidecar.
+func (s *AssetStore) Put(ctx context.Context, body io.Reader, metadata AssetMetadata) (*AssetMetadata, error) {
+	// Spool to disk: the key is only known once the content is hashed, and
+	// S3 signs the payload hash before the upload starts.
+	file, err := os.CreateTemp("", "asset-*.mp4")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create asset spool file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset: %w", err)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("asset is empty")
+	}
+	metadata.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	metadata.Size = size
+	if metadata.ContentType == "" {
+		metadata.ContentType = "video/mp4"
+	}
+
+	if existing, err := s.Metadata(ctx, metadata.SHA256); err == nil {
+		return existing, nil
+	} else if !errors.Is(err, ErrAssetNotFound) {
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind asset spool file: %w", err)
+	}
+	if err := s.backend.Put(ctx, assetKey(metadata.SHA256), file); err != nil {
+		return nil, fmt.Errorf("failed to store asset %s: %w", metadata.SHA256, err)
+	}
+
+	// The sidecar is written last, so an asset with a sidecar is complete.
+	metadata.CreatedAt = time.Now()
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode asset metadata: %w", err)
+	}
+	if err := s.backend.Put(ctx, assetMetadataKey(metadata.SHA256), bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to store asset metadata %s: %w", metadata.SHA256, err)
+	}
+	return &metadata, nil
+}
+
+func (s *AssetStore) Metadata(ctx context.Context, sha string) (*AssetMetadata, error) {
+	if !isAssetHash(sha) {
+		return nil, fmt.Errorf("invalid asset hash %q", sha)
+	}
+	body, err := s.backend.Get(ctx, assetMetadataKey(sha))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var metadata AssetMetadata
+	if err := json.NewDecoder(body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode asset metadata %s: %w", sha, err)
+	}
+	return &metadata, nil
+}
+
+// Open returns the content of an asset.
+func (s *AssetStore) Open(ctx context.Context, sha string) (io.ReadCloser, error) {
+	if !isAssetHash(sha) {
+		return nil, fmt.Errorf("invalid asset hash %q", sha)
+	}
+	return s.backend.Get(ctx, assetKey(sha))
+}
+
+// Ingest downloads a finished video into the store and records its hash as
+// AssetSHA256. Videos saved locally by their backend are read from
+// LocalPath; otherwise fetch downloads them.
+func (s *AssetStore) Ingest(ctx context.Context, video *GeneratedVideo, fetch func(ctx context.Context) (io.ReadCloser, error)) error {
+	var body io.ReadCloser
+	var err error
+	if video.LocalPath != "" {
+		body, err = os.Open(video.LocalPath)
+	} else {
+		body, err = fetch(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download video %s: %w", video.ID, err)
+	}
+	defer body.Close()
+
+	metadata, err := s.Put(ctx, body, AssetMetadata{
+		VideoID:   video.ID,
+		PromptID:  video.PromptID,
+		Provider:  video.Provider,
+		SourceURL: video.VideoURL,
+	})
+	if err != nil {
+		return err
+	}
+	video.AssetSHA256 = metadata.SHA256
+	return nil
+}
+
+// downloadVideo fetches a public video URL. Backends whose URLs need
+// credentials implement VideoFetcher instead.
+func downloadVideo(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+	// Videos can take longer to download than an API call.
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("download failed: %w", &VideoHTTPError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+	return resp.Body, nil
+}
+
+// GC deletes the assets not in referenced, except those stored after
+// keepAfter, which may belong to videos still being generated, and the
+// post-processed versions of assets that are kept. It returns the hashes
+// it deleted, or would delete when dryRun is set.
+func (s *AssetStore) GC(ctx context.Context, referenced map[string]bool, keepAfter time.Time, dryRun bool) ([]string, error) {
+	objects, err := s.backend.List(ctx, assetPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assets: %w", err)
+	}
+
+	// An asset is its content object and its sidecar; either may be
+	// missing after a crash.
+	keys := make(map[string][]string)
+	recent := make(map[string]bool)
+	for _, object := range objects {
+		name := path.Base(object.Key)
+		sha := strings.TrimSuffix(strings.TrimSuffix(name, ".mp4"), ".json")
+		if !isAssetHash(sha) {
+			continue
+		}
+		keys[sha] = append(keys[sha], object.Key)
+		if object.LastModified.After(keepAfter) {
+			recent[sha] = true
+		}
+	}
+
+	parents := make(map[string]string)
+	for sha := range keys {
+		if referenced[sha] || recent[sha] {
+			continue
+		}
+		metadata, err := s.Metadata(ctx, sha)
+		if err == nil {
+			parents[sha] = metadata.Parent
+		} else if !errors.Is(err, ErrAssetNotFound) {
+			return nil, err
+		}
+	}
+	kept := func(sha string) bool {
+		seen := make(map[string]bool)
+		for sha != "" && !seen[sha] {
+			if referenced[sha] || recent[sha] {
+				return true
+			}
+			seen[sha] = true
+			sha = parents[sha]
+		}
+		return false
+	}
+
+	var removed []string
+	for sha, shaKeys := range keys {
+		if kept(sha) {
+			continue
+		}
+		if !dryRun {
+			for _, key := range shaKeys {
+				if err := s.backend.Delete(ctx, key); err != nil {
+					return removed, fmt.Errorf("failed to delete asset %s: %w", key, err)
+				}
+			}
+		}
+		removed = append(removed, sha)
+	}
+	return removed, nil
+}
+
+func isAssetHash(sha string) bool {
+	if len(sha) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sha)
+	return err == nil && strings.ToLower(sha) == sha
+}
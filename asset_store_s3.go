@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadSHA256 is the SHA-256 of an empty request body.
+const emptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3AssetBackend stores objects in an S3 bucket, or any S3-compatible API
+// such as MinIO. Requests use path-style addressing and Signature Version 4.
+type S3AssetBackend struct {
+	endpoint     *url.URL
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+type S3Config struct {
+	// Endpoint defaults to AWS for Region, e.g. http://localhost:9000 for
+	// a local MinIO.
+	Endpoint     string
+	Bucket       string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+func NewS3AssetBackend(config S3Config) (*S3AssetBackend, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("S3 asset store needs a bucket")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3 asset store needs an access key and secret key")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3 endpoint must be an http(s) URL, got %q", config.Endpoint)
+	}
+
+	return &S3AssetBackend{
+		endpoint:     endpoint,
+		bucket:       config.Bucket,
+		region:       config.Region,
+		accessKey:    config.AccessKey,
+		secretKey:    config.SecretKey,
+		sessionToken: config.SessionToken,
+		client:       &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// NewS3AssetBackendFromEnv reads ASSET_S3_BUCKET, ASSET_S3_ENDPOINT and
+// ASSET_S3_REGION, and the credentials from ASSET_S3_ACCESS_KEY_ID and
+// ASSET_S3_SECRET_ACCESS_KEY or the standard AWS variables.
+func NewS3AssetBackendFromEnv() (*S3AssetBackend, error) {
+	return NewS3AssetBackend(S3Config{
+		Endpoint:     os.Getenv("ASSET_S3_ENDPOINT"),
+		Bucket:       os.Getenv("ASSET_S3_BUCKET"),
+		Region:       getEnvWithDefault("ASSET_S3_REGION", os.Getenv("AWS_REGION")),
+		AccessKey:    getEnvWithDefault("ASSET_S3_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+		SecretKey:    getEnvWithDefault("ASSET_S3_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	})
+}
+
+func (b *S3AssetBackend) String() string {
+	return fmt.Sprintf("s3://%s (%s)", b.bucket, b.endpoint.Host)
+}
+
+func (b *S3AssetBackend) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	resp, err := b.do(ctx, "PUT", key, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("PUT", key, resp)
+	}
+	return nil
+}
+
+func (b *S3AssetBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, "GET", key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrAssetNotFound, key)
+	default:
+		defer resp.Body.Close()
+		return nil, s3Error("GET", key, resp)
+	}
+}
+
+func (b *S3AssetBackend) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := b.do(ctx, "HEAD", key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3Error("HEAD", key, resp)
+	}
+}
+
+func (b *S3AssetBackend) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, "DELETE", key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return s3Error("DELETE", key, resp)
+	}
+	return nil
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func (b *S3AssetBackend) List(ctx context.Context, prefix string) ([]AssetObject, error) {
+	var objects []AssetObject
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := b.do(ctx, "GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			return nil, s3Error("LIST", prefix, resp)
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode S3 listing: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, AssetObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (b *S3AssetBackend) do(ctx context.Context, method, key string, query url.Values, body io.ReadSeeker) (*http.Response, error) {
+	payloadHash := emptyPayloadSHA256
+	var length int64
+	if body != nil {
+		hash := sha256.New()
+		n, err := io.Copy(hash, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash S3 upload: %w", err)
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to rewind S3 upload: %w", err)
+		}
+		payloadHash = hex.EncodeToString(hash.Sum(nil))
+		length = n
+	}
+
+	canonicalURI := s3Escape("/"+b.bucket+"/"+key, false)
+	canonicalQuery := s3CanonicalQuery(query)
+	target := b.endpoint.Scheme + "://" + b.endpoint.Host + canonicalURI
+	if canonicalQuery != "" {
+		target += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 request: %w", err)
+	}
+	if body != nil {
+		req.Body = io.NopCloser(body)
+		req.ContentLength = length
+	}
+	b.sign(req, canonicalURI, canonicalQuery, payloadHash, time.Now().UTC())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s %s failed: %w", method, key, err)
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 headers to req.
+func (b *S3AssetBackend) sign(req *http.Request, canonicalURI, canonicalQuery, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if b.sessionToken != "" {
+		headers["x-amz-security-token"] = b.sessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+		if name != "host" {
+			req.Header.Set(name, headers[name])
+		}
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+b.secretKey), date)
+	signingKey = hmacSHA256(signingKey, b.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set, as Signature Version 4 requires.
+func s3Escape(s string, encodeSlash bool) string {
+	var escaped strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			escaped.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func s3Error(operation, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("S3 %s %s failed with %d %s: %s", operation, key, resp.StatusCode, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("S3 %s %s failed with %d", operation, key, resp.StatusCode)
+}
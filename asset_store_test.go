@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAssetStore returns a store on a local backend in a temporary
+// directory, and that directory.
+func testAssetStore(t *testing.T) (*AssetStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	backend, err := NewLocalAssetBackend(dir)
+	if err != nil {
+		t.Fatalf("NewLocalAssetBackend() error = %v", err)
+	}
+	return NewAssetStore(backend), dir
+}
+
+func putTestAsset(t *testing.T, store *AssetStore, content, parent string) string {
+	t.Helper()
+	metadata, err := store.Put(context.Background(), strings.NewReader(content), AssetMetadata{Parent: parent})
+	if err != nil {
+		t.Fatalf("Put(%q) error = %v", content, err)
+	}
+	return metadata.SHA256
+}
+
+// ageTestAsset backdates every object of an asset to modified.
+func ageTestAsset(t *testing.T, dir, sha string, modified time.Time) {
+	t.Helper()
+	for _, key := range []string{assetKey(sha), assetMetadataKey(sha)} {
+		path := filepath.Join(dir, filepath.FromSlash(key))
+		if err := os.Chtimes(path, modified, modified); err != nil && !os.IsNotExist(err) {
+			t.Fatalf("Chtimes(%s) error = %v", path, err)
+		}
+	}
+}
+
+func assetObjectExists(t *testing.T, dir, key string) bool {
+	t.Helper()
+	_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(key)))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Stat(%s) error = %v", key, err)
+	}
+	return err == nil
+}
+
+func TestAssetStoreGC(t *testing.T) {
+	ctx := context.Background()
+	store, dir := testAssetStore(t)
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	keepAfter := now.Add(-24 * time.Hour)
+
+	referenced := putTestAsset(t, store, "referenced", "")
+	child := putTestAsset(t, store, "child of referenced", referenced)
+	grandchild := putTestAsset(t, store, "grandchild of referenced", child)
+	recent := putTestAsset(t, store, "recent", "")
+	// Only versions of kept assets are kept, not the source of a recent one.
+	oldParent := putTestAsset(t, store, "old parent of recent child", "")
+	recentChild := putTestAsset(t, store, "recent child", oldParent)
+	orphan := putTestAsset(t, store, "orphan", "")
+	orphanChild := putTestAsset(t, store, "child of orphan", orphan)
+	noSidecar := putTestAsset(t, store, "missing its sidecar", "")
+	onlySidecar := putTestAsset(t, store, "missing its content", "")
+
+	for _, sha := range []string{referenced, child, grandchild, oldParent, orphan, orphanChild, noSidecar, onlySidecar} {
+		ageTestAsset(t, dir, sha, old)
+	}
+	// A crash can leave either half of an asset behind.
+	if err := os.Remove(filepath.Join(dir, filepath.FromSlash(assetMetadataKey(noSidecar)))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, filepath.FromSlash(assetKey(onlySidecar)))); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := store.GC(ctx, map[string]bool{referenced: true}, keepAfter, false)
+	if err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+
+	wantRemoved := []string{oldParent, orphan, orphanChild, noSidecar, onlySidecar}
+	sort.Strings(removed)
+	sort.Strings(wantRemoved)
+	if strings.Join(removed, ",") != strings.Join(wantRemoved, ",") {
+		t.Errorf("GC() removed %v, want %v", removed, wantRemoved)
+	}
+
+	names := map[string]string{
+		referenced:  "referenced",
+		child:       "child of referenced",
+		grandchild:  "grandchild of referenced",
+		recent:      "recent",
+		recentChild: "recent child",
+	}
+	for sha, name := range names {
+		if !assetObjectExists(t, dir, assetKey(sha)) || !assetObjectExists(t, dir, assetMetadataKey(sha)) {
+			t.Errorf("GC() deleted %s asset %s", name, sha)
+		}
+	}
+	for _, sha := range wantRemoved {
+		if assetObjectExists(t, dir, assetKey(sha)) || assetObjectExists(t, dir, assetMetadataKey(sha)) {
+			t.Errorf("GC() left objects of asset %s", sha)
+		}
+	}
+}
+
+func TestAssetStoreGCDryRun(t *testing.T) {
+	store, dir := testAssetStore(t)
+
+	orphan := putTestAsset(t, store, "orphan", "")
+	ageTestAsset(t, dir, orphan, time.Now().Add(-48*time.Hour))
+
+	removed, err := store.GC(context.Background(), nil, time.Now().Add(-24*time.Hour), true)
+	if err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+	if len(removed) != 1 || removed[0] != orphan {
+		t.Errorf("GC() removed %v, want [%s]", removed, orphan)
+	}
+	if !assetObjectExists(t, dir, assetKey(orphan)) || !assetObjectExists(t, dir, assetMetadataKey(orphan)) {
+		t.Errorf("GC() with dryRun deleted asset %s", orphan)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type BanditConfig struct {
+	// Exploration scales posterior uncertainty: 1 is plain Thompson
+	// sampling, higher values try unproven entries more often, lower
+	// values stick with known winners.
+	Exploration float64
+	// RewardCeiling is the engagement rate treated as a full success.
+	RewardCeiling float64
+	StatePath     string
+}
+
+type ArmStats struct {
+	Successes float64 `json:"successes"`
+	Failures  float64 `json:"failures"`
+	Pulls     int     `json:"pulls"`
+}
+
+type banditPrompt struct {
+	Theme     string    `json:"theme"`
+	Situation string    `json:"situation"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type banditState struct {
+	Themes     map[string]*ArmStats     `json:"themes"`
+	Situations map[string]*ArmStats     `json:"situations"`
+	Prompts    map[string]*banditPrompt `json:"prompts"`
+}
+
+// PromptBandit picks themes and situations by Thompson sampling over
+// Beta posteriors fed by post engagement.
+type PromptBandit struct {
+	config BanditConfig
+	state  banditState
+	mu     sync.Mutex
+}
+
+const banditPromptRetention = 30 * 24 * time.Hour
+
+func NewBanditConfigFromEnv() (BanditConfig, error) {
+	config := BanditConfig{
+		Exploration:   1.0,
+		RewardCeiling: 0.1,
+		StatePath:     os.Getenv("BANDIT_STATE_PATH"),
+	}
+
+	if value := os.Getenv("BANDIT_EXPLORATION"); value != "" {
+		exploration, err := strconv.ParseFloat(value, 64)
+		if err != nil || exploration <= 0 {
+			return config, fmt.Errorf("BANDIT_EXPLORATION must be a positive number, got %q", value)
+		}
+		config.Exploration = exploration
+	}
+
+	if value := os.Getenv("BANDIT_REWARD_CEILING"); value != "" {
+		ceiling, err := strconv.ParseFloat(value, 64)
+		if err != nil || ceiling <= 0 {
+			return config, fmt.Errorf("BANDIT_REWARD_CEILING must be a positive number, got %q", value)
+		}
+		config.RewardCeiling = ceiling
+	}
+
+	return config, nil
+}
+
+func LoadPromptBandit(config BanditConfig) (*PromptBandit, error) {
+	if config.Exploration <= 0 {
+		config.Exploration = 1.0
+	}
+	if config.RewardCeiling <= 0 {
+		config.RewardCeiling = 0.1
+	}
+
+	b := &PromptBandit{
+		config: config,
+		state: banditState{
+			Themes:     make(map[string]*ArmStats),
+			Situations: make(map[string]*ArmStats),
+			Prompts:    make(map[string]*banditPrompt),
+		},
+	}
+
+	if config.StatePath == "" {
+		return b, nil
+	}
+
+	data, err := os.ReadFile(config.StatePath)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bandit state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &b.state); err != nil {
+		return nil, fmt.Errorf("failed to decode bandit state: %w", err)
+	}
+	if b.state.Themes == nil {
+		b.state.Themes = make(map[string]*ArmStats)
+	}
+	if b.state.Situations == nil {
+		b.state.Situations = make(map[string]*ArmStats)
+	}
+	if b.state.Prompts == nil {
+		b.state.Prompts = make(map[string]*banditPrompt)
+	}
+
+	return b, nil
+}
+
+func (b *PromptBandit) ChooseTheme(entries []CatalogEntry, rng *rand.Rand) CatalogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.choose(entries, b.state.Themes, rng)
+}
+
+func (b *PromptBandit) ChooseSituation(entries []CatalogEntry, rng *rand.Rand) CatalogEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.choose(entries, b.state.Situations, rng)
+}
+
+// banditPriorStrength is how many posts' worth of evidence the catalog
+// weight is worth, the same as a uniform Beta(1, 1) prior.
+const banditPriorStrength = 2.0
+
+// choose draws one sample per enabled entry and keeps the best. The catalog
+// weight sets the prior mean relative to the other entries' weights, so
+// only the ratios between weights matter, and the prior is worth
+// banditPriorStrength posts whatever the weight, so writers' preferences
+// matter until a few posts of real engagement outweigh them.
+func (b *PromptBandit) choose(entries []CatalogEntry, arms map[string]*ArmStats, rng *rand.Rand) CatalogEntry {
+	active := enabledEntries(entries)
+
+	meanWeight := 0.0
+	for _, entry := range active {
+		meanWeight += entry.Weight
+	}
+	meanWeight /= float64(len(active))
+
+	best := active[0]
+	bestSample := -1.0
+	for _, entry := range active {
+		// An entry of average weight gets Beta(1, 1); heavier entries lean
+		// towards success and lighter ones towards failure.
+		priorMean := entry.Weight / (entry.Weight + meanWeight)
+		alpha, beta := banditPriorStrength*priorMean, banditPriorStrength*(1-priorMean)
+		if stats, ok := arms[entry.Text]; ok {
+			alpha += stats.Successes
+			beta += stats.Failures
+		}
+
+		sample := sampleBeta(rng, alpha/b.config.Exploration, beta/b.config.Exploration)
+		if sample > bestSample {
+			best = entry
+			bestSample = sample
+		}
+	}
+
+	return best
+}
+
+func (b *PromptBandit) RecordPrompt(prompt *VideoPrompt) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state.Prompts[prompt.ID] = &banditPrompt{
+		Theme:     prompt.Theme,
+		Situation: prompt.Situation,
+		CreatedAt: prompt.CreatedAt,
+	}
+
+	return b.save()
+}
+
+// Observe credits a post's engagement to the theme and situation of the
+// prompt behind it. Unknown prompts are ignored.
+func (b *PromptBandit) Observe(promptID string, engagementRate float64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prompt, ok := b.state.Prompts[promptID]
+	if !ok {
+		return nil
+	}
+
+	reward := math.Max(0, math.Min(1, engagementRate/b.config.RewardCeiling))
+	updateArm(b.state.Themes, prompt.Theme, reward)
+	updateArm(b.state.Situations, prompt.Situation, reward)
+
+	return b.save()
+}
+
+func (b *PromptBandit) ObservePerformance(performance PostPerformance) {
+	if performance.PromptID == "" {
+		return
+	}
+	if err := b.Observe(performance.PromptID, performance.EngagementRate); err != nil {
+		fmt.Printf("Failed to update prompt bandit: %v\n", err)
+	}
+}
+
+func (b *PromptBandit) Save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.save()
+}
+
+func (b *PromptBandit) save() error {
+	if b.config.StatePath == "" {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-banditPromptRetention)
+	for id, prompt := range b.state.Prompts {
+		if prompt.CreatedAt.Before(cutoff) {
+			delete(b.state.Prompts, id)
+		}
+	}
+
+	return writeJSONFile(b.config.StatePath, b.state)
+}
+
+func (b *PromptBandit) ThemeStats() map[string]ArmStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return copyArmStats(b.state.Themes)
+}
+
+func (b *PromptBandit) SituationStats() map[string]ArmStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return copyArmStats(b.state.Situations)
+}
+
+func updateArm(arms map[string]*ArmStats, key string, reward float64) {
+	stats, ok := arms[key]
+	if !ok {
+		stats = &ArmStats{}
+		arms[key] = stats
+	}
+	stats.Successes += reward
+	stats.Failures += 1 - reward
+	stats.Pulls++
+}
+
+func copyArmStats(arms map[string]*ArmStats) map[string]ArmStats {
+	result := make(map[string]ArmStats, len(arms))
+	for key, stats := range arms {
+		result[key] = *stats
+	}
+	return result
+}
+
+// writeJSONFile writes via a temp file and rename so a crash never leaves
+// a half-written state file behind.
+func writeJSONFile(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", path, err)
+		}
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+func sampleBeta(rng *rand.Rand, alpha, beta float64) float64 {
+	x := sampleGamma(rng, alpha)
+	y := sampleGamma(rng, beta)
+	if x+y == 0 {
+		return 0.5
+	}
+	return x / (x + y)
+}
+
+// sampleGamma uses Marsaglia and Tsang's method, boosting shapes below one.
+func sampleGamma(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		return sampleGamma(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+
+	d := shape - 1.0/3.0
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
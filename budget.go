@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrBudgetExceeded = errors.New("generation budget exceeded")
+
+// Accounts not listed in any group share this group's caps.
+const defaultBudgetGroup = "default"
+
+const (
+	BudgetDowngrade = "downgrade"
+	BudgetRefuse    = "refuse"
+)
+
+// TokenPrice is USD per million tokens.
+type TokenPrice struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// PriceTable holds list prices. Video prices are USD per second of video
+// and default to each backend's Capabilities.PricePerSecond; token prices
+// are keyed by prompt model name as PromptModel.Name reports it.
+type PriceTable struct {
+	Video  map[VideoProvider]float64 `yaml:"video"`
+	Tokens map[string]TokenPrice     `yaml:"tokens"`
+}
+
+// BudgetCaps are USD limits per calendar day, week (starting Monday) and
+// month in local time. Zero means no limit.
+type BudgetCaps struct {
+	Daily   float64 `yaml:"daily"`
+	Weekly  float64 `yaml:"weekly"`
+	Monthly float64 `yaml:"monthly"`
+}
+
+type BudgetGroup struct {
+	Accounts   []string `yaml:"accounts"`
+	BudgetCaps `yaml:",inline"`
+	// OnExceed is what happens to a request that would go over a cap:
+	// "downgrade" (the default) moves videos to a cheaper provider later in
+	// the failover chain and prompts to the template fallback, "refuse"
+	// fails the request.
+	OnExceed string `yaml:"on_exceed"`
+}
+
+type BudgetConfig struct {
+	Prices PriceTable              `yaml:"prices"`
+	Groups map[string]*BudgetGroup `yaml:"groups"`
+}
+
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		Video: make(map[VideoProvider]float64),
+		Tokens: map[string]TokenPrice{
+			"openai/gpt-4o-mini":      {Input: 0.15, Output: 0.60},
+			"openai/gpt-4o":           {Input: 2.50, Output: 10.00},
+			"gemini/gemini-1.5-flash": {Input: 0.075, Output: 0.30},
+		},
+	}
+}
+
+func LoadBudgetConfig(path string) (*BudgetConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budget config: %w", err)
+	}
+
+	var config BudgetConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse budget config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// Budget prices generation requests, records them in a CostLedger and
+// enforces each account group's caps. Estimated costs are reserved while a
+// request is in flight so concurrent requests cannot overshoot a cap
+// together.
+type Budget struct {
+	prices   PriceTable
+	groups   map[string]*BudgetGroup
+	accounts map[string]string
+	ledger   *CostLedger
+	reserved map[string]float64
+	unpriced map[string]bool
+	mu       sync.Mutex
+}
+
+type BudgetReservation struct {
+	budget    *Budget
+	group     string
+	accountID string
+	amount    float64
+	done      bool
+}
+
+func NewBudget(config *BudgetConfig, ledger *CostLedger) (*Budget, error) {
+	b := &Budget{
+		prices:   DefaultPriceTable(),
+		groups:   make(map[string]*BudgetGroup),
+		accounts: make(map[string]string),
+		ledger:   ledger,
+		reserved: make(map[string]float64),
+		unpriced: make(map[string]bool),
+	}
+	if config == nil {
+		return b, nil
+	}
+
+	for provider, price := range config.Prices.Video {
+		if price < 0 {
+			return nil, fmt.Errorf("budget prices: %s price must not be negative", provider)
+		}
+		b.prices.Video[provider] = price
+	}
+	for model, price := range config.Prices.Tokens {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("budget prices: %s price must not be negative", model)
+		}
+		b.prices.Tokens[model] = price
+	}
+
+	for name, group := range config.Groups {
+		if group == nil {
+			group = &BudgetGroup{}
+		}
+		if group.Daily < 0 || group.Weekly < 0 || group.Monthly < 0 {
+			return nil, fmt.Errorf("budget group %s: caps must not be negative", name)
+		}
+		switch group.OnExceed {
+		case "":
+			group.OnExceed = BudgetDowngrade
+		case BudgetDowngrade, BudgetRefuse:
+		default:
+			return nil, fmt.Errorf("budget group %s: on_exceed must be %s or %s, got %q", name, BudgetDowngrade, BudgetRefuse, group.OnExceed)
+		}
+		for _, accountID := range group.Accounts {
+			if other, ok := b.accounts[accountID]; ok {
+				return nil, fmt.Errorf("account %s is in budget groups %s and %s", accountID, other, name)
+			}
+			b.accounts[accountID] = name
+		}
+		b.groups[name] = group
+	}
+
+	return b, nil
+}
+
+// NewBudgetFromEnv builds the budget from BUDGET_LEDGER_PATH and
+// BUDGET_CONFIG_PATH. It returns nil when neither is set; spend is only
+// tracked, not capped, without a config.
+func NewBudgetFromEnv() (*Budget, error) {
+	ledgerPath := os.Getenv("BUDGET_LEDGER_PATH")
+	configPath := os.Getenv("BUDGET_CONFIG_PATH")
+	if ledgerPath == "" && configPath == "" {
+		return nil, nil
+	}
+	if ledgerPath == "" {
+		return nil, fmt.Errorf("BUDGET_LEDGER_PATH is required to enforce BUDGET_CONFIG_PATH")
+	}
+
+	var config *BudgetConfig
+	if configPath != "" {
+		var err error
+		if config, err = LoadBudgetConfig(configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	ledger, err := LoadCostLedger(ledgerPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewBudget(config, ledger)
+}
+
+func (b *Budget) Ledger() *CostLedger {
+	return b.ledger
+}
+
+// Group returns the budget group an account's spend counts against.
+func (b *Budget) Group(accountID string) string {
+	if group, ok := b.accounts[accountID]; ok {
+		return group
+	}
+	return defaultBudgetGroup
+}
+
+// Refuses reports whether requests for the account fail rather than
+// downgrade when they would go over budget.
+func (b *Budget) Refuses(accountID string) bool {
+	group, ok := b.groups[b.Group(accountID)]
+	return ok && group.OnExceed == BudgetRefuse
+}
+
+func (b *Budget) VideoCost(provider VideoProvider, seconds int) float64 {
+	price, ok := b.prices.Video[provider]
+	if !ok {
+		// Backends register in init, so their list prices are looked up
+		// when first needed rather than when the table is built.
+		spec, registered := LookupVideoBackend(provider)
+		if !registered {
+			b.warnUnpriced(string(provider))
+		}
+		price = spec.Capabilities.PricePerSecond
+	}
+	return price * float64(seconds)
+}
+
+func (b *Budget) TokenCost(model string, promptTokens, completionTokens int) float64 {
+	price, ok := b.prices.Tokens[model]
+	if !ok {
+		// Local models cost nothing per token.
+		if !strings.HasPrefix(model, string(PromptModelLocal)+"/") {
+			b.warnUnpriced(model)
+		}
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
+
+func (b *Budget) warnUnpriced(item string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.unpriced[item] {
+		b.unpriced[item] = true
+		fmt.Printf("Warning: no price for %s, its spend is recorded as $0\n", item)
+	}
+}
+
+type budgetPeriod struct {
+	name  string
+	cap   float64
+	start time.Time
+}
+
+func budgetPeriodStarts(now time.Time) (day, week, month time.Time) {
+	day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	week = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return day, week, month
+}
+
+func (caps BudgetCaps) periods(now time.Time) []budgetPeriod {
+	day, week, month := budgetPeriodStarts(now)
+	return []budgetPeriod{
+		{"daily", caps.Daily, day},
+		{"weekly", caps.Weekly, week},
+		{"monthly", caps.Monthly, month},
+	}
+}
+
+// Reserve holds estimate against the account's group until the returned
+// reservation is committed or released. It fails with ErrBudgetExceeded
+// when the estimate would take the group over any of its caps.
+func (b *Budget) Reserve(accountID string, estimate float64) (*BudgetReservation, error) {
+	name := b.Group(accountID)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if group, ok := b.groups[name]; ok {
+		for _, period := range group.periods(time.Now()) {
+			if period.cap <= 0 {
+				continue
+			}
+			spent := b.ledger.Spent(name, period.start) + b.reserved[name]
+			if spent+estimate > period.cap {
+				return nil, fmt.Errorf("%w: %s has spent $%.2f of its $%.2f %s cap, this request needs about $%.2f", ErrBudgetExceeded, name, spent, period.cap, period.name, estimate)
+			}
+		}
+	}
+
+	b.reserved[name] += estimate
+	return &BudgetReservation{budget: b, group: name, accountID: accountID, amount: estimate}, nil
+}
+
+// Commit records the actual spend in the ledger and frees the estimate.
+// A nil reservation does nothing, so callers without a budget can use it.
+func (r *BudgetReservation) Commit(entry SpendEntry) error {
+	if r == nil || r.done {
+		return nil
+	}
+	defer r.Release()
+	return r.budget.Record(r.accountID, entry)
+}
+
+// Record adds spend to the ledger without checking the caps, for requests
+// that were paid for before this process could reserve them.
+func (b *Budget) Record(accountID string, entry SpendEntry) error {
+	entry.Time = time.Now()
+	entry.Group = b.Group(accountID)
+	entry.AccountID = accountID
+	return b.ledger.Add(entry)
+}
+
+// Release frees the estimate without recording spend, for requests that
+// failed before they were billed.
+func (r *BudgetReservation) Release() {
+	if r == nil || r.done {
+		return
+	}
+	r.done = true
+
+	r.budget.mu.Lock()
+	defer r.budget.mu.Unlock()
+	r.budget.reserved[r.group] -= r.amount
+}
+
+type GroupSpend struct {
+	Group   string
+	Caps    BudgetCaps
+	Daily   float64
+	Weekly  float64
+	Monthly float64
+	// ByItem is this month's spend per kind and provider or model.
+	ByItem map[string]float64
+}
+
+// Report totals every group's spend for the current day, week and month.
+// Groups appear if they are configured or spent anything this week or
+// month.
+func (b *Budget) Report(now time.Time) []GroupSpend {
+	day, week, month := budgetPeriodStarts(now)
+	since := month
+	if week.Before(since) {
+		since = week
+	}
+
+	spend := make(map[string]*GroupSpend)
+	groupSpend := func(name string) *GroupSpend {
+		if _, ok := spend[name]; !ok {
+			spend[name] = &GroupSpend{Group: name, ByItem: make(map[string]float64)}
+			if group, ok := b.groups[name]; ok {
+				spend[name].Caps = group.BudgetCaps
+			}
+		}
+		return spend[name]
+	}
+
+	for name := range b.groups {
+		groupSpend(name)
+	}
+	for _, entry := range b.ledger.Since(since) {
+		if entry.Time.After(now) {
+			continue
+		}
+		gs := groupSpend(entry.Group)
+		if !entry.Time.Before(week) {
+			gs.Weekly += entry.Cost
+		}
+		if !entry.Time.Before(day) {
+			gs.Daily += entry.Cost
+		}
+		if !entry.Time.Before(month) {
+			gs.Monthly += entry.Cost
+			gs.ByItem[fmt.Sprintf("%s %s", entry.Kind, entry.Item)] += entry.Cost
+		}
+	}
+
+	report := make([]GroupSpend, 0, len(spend))
+	for _, gs := range spend {
+		report = append(report, *gs)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Group < report[j].Group
+	})
+	return report
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type CatalogEntry struct {
+	Text    string   `json:"text"`
+	Weight  float64  `json:"weight"`
+	Tags    []string `json:"tags,omitempty"`
+	Enabled bool     `json:"enabled"`
+	Line    int      `json:"-"`
+}
+
+type PromptCatalog struct {
+	Themes     []CatalogEntry `json:"themes"`
+	Situations []CatalogEntry `json:"situations"`
+}
+
+type CatalogProblem struct {
+	Line    int
+	Message string
+}
+
+type CatalogError struct {
+	Path     string
+	Problems []CatalogProblem
+}
+
+func (e *CatalogError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		lines = append(lines, fmt.Sprintf("%s:%d: %s", e.Path, problem.Line, problem.Message))
+	}
+	return fmt.Sprintf("invalid prompt catalog (%d problems):\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+func DefaultPromptCatalog() *PromptCatalog {
+	return &PromptCatalog{
+		Themes: catalogEntries(
+			"existential dread",
+			"corporate middle management",
+			"gen z slang misuse",
+			"cryptocurrency obsession",
+			"wellness influencer parody",
+			"linkedin motivational posts",
+			"artisanal everything",
+			"sustainable living anxiety",
+			"dating app failures",
+			"work from home chaos",
+		),
+		Situations: catalogEntries(
+			"realizes they've been eating the same cardboard for 3 years",
+			"discovers their humans are just large, hairless cats",
+			"starts a podcast about the futility of chasing laser dots",
+			"becomes a life coach for other cats",
+			"opens a meditation retreat for anxious house pets",
+			"launches a startup selling cardboard boxes as premium furniture",
+			"writes passive-aggressive emails to their food dispenser",
+			"practices mindfulness while knocking things off tables",
+			"develops an elaborate conspiracy theory about vacuum cleaners",
+			"starts a support group for cats with imposter syndrome",
+		),
+	}
+}
+
+func catalogEntries(texts ...string) []CatalogEntry {
+	entries := make([]CatalogEntry, 0, len(texts))
+	for _, text := range texts {
+		entries = append(entries, CatalogEntry{Text: text, Weight: 1, Enabled: true})
+	}
+	return entries
+}
+
+// LoadPromptCatalog reads a YAML or JSON catalog (JSON is valid YAML) and
+// reports every invalid entry with its line number rather than stopping at
+// the first one.
+func LoadPromptCatalog(path string) (*PromptCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse catalog %s: %w", path, err)
+	}
+
+	catalog := &PromptCatalog{}
+	var problems []CatalogProblem
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, &CatalogError{Path: path, Problems: []CatalogProblem{{Line: 1, Message: "catalog must be a mapping with themes and situations"}}}
+	}
+
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "themes":
+			catalog.Themes, problems = parseCatalogSection(value, "themes", problems)
+		case "situations":
+			catalog.Situations, problems = parseCatalogSection(value, "situations", problems)
+		default:
+			problems = append(problems, CatalogProblem{Line: key.Line, Message: fmt.Sprintf("unknown section %q", key.Value)})
+		}
+	}
+
+	if len(enabledEntries(catalog.Themes)) == 0 {
+		problems = append(problems, CatalogProblem{Line: root.Line, Message: "catalog needs at least one enabled theme"})
+	}
+	if len(enabledEntries(catalog.Situations)) == 0 {
+		problems = append(problems, CatalogProblem{Line: root.Line, Message: "catalog needs at least one enabled situation"})
+	}
+
+	if len(problems) > 0 {
+		return nil, &CatalogError{Path: path, Problems: problems}
+	}
+
+	return catalog, nil
+}
+
+func parseCatalogSection(node *yaml.Node, section string, problems []CatalogProblem) ([]CatalogEntry, []CatalogProblem) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, append(problems, CatalogProblem{Line: node.Line, Message: fmt.Sprintf("%s must be a list", section)})
+	}
+
+	entries := make([]CatalogEntry, 0, len(node.Content))
+	seen := make(map[string]int)
+
+	for _, item := range node.Content {
+		entry, entryProblems := parseCatalogEntry(item)
+		if len(entryProblems) > 0 {
+			problems = append(problems, entryProblems...)
+			continue
+		}
+
+		key := strings.ToLower(entry.Text)
+		if firstLine, exists := seen[key]; exists {
+			problems = append(problems, CatalogProblem{Line: entry.Line, Message: fmt.Sprintf("duplicate %s entry %q (first defined on line %d)", section, entry.Text, firstLine)})
+			continue
+		}
+		seen[key] = entry.Line
+
+		entries = append(entries, entry)
+	}
+
+	return entries, problems
+}
+
+func parseCatalogEntry(node *yaml.Node) (CatalogEntry, []CatalogProblem) {
+	entry := CatalogEntry{Weight: 1, Enabled: true, Line: node.Line}
+
+	// Plain strings are shorthand for an enabled entry with weight 1.
+	if node.Kind == yaml.ScalarNode {
+		entry.Text = strings.TrimSpace(node.Value)
+		if entry.Text == "" {
+			return entry, []CatalogProblem{{Line: node.Line, Message: "entry text is empty"}}
+		}
+		return entry, nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return entry, []CatalogProblem{{Line: node.Line, Message: "entry must be a string or a mapping"}}
+	}
+
+	var problems []CatalogProblem
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		var err error
+
+		switch key.Value {
+		case "text":
+			err = value.Decode(&entry.Text)
+			entry.Text = strings.TrimSpace(entry.Text)
+		case "weight":
+			err = value.Decode(&entry.Weight)
+			if err == nil && (math.IsNaN(entry.Weight) || math.IsInf(entry.Weight, 0)) {
+				err = fmt.Errorf("must be a finite number")
+			} else if err == nil && entry.Weight <= 0 {
+				err = fmt.Errorf("must be greater than zero (use enabled: false to turn an entry off)")
+			}
+		case "tags":
+			err = value.Decode(&entry.Tags)
+			for _, tag := range entry.Tags {
+				if strings.TrimSpace(tag) == "" {
+					err = fmt.Errorf("must not contain empty tags")
+				}
+			}
+		case "enabled":
+			err = value.Decode(&entry.Enabled)
+		default:
+			err = fmt.Errorf("unknown field")
+		}
+
+		if err != nil {
+			problems = append(problems, CatalogProblem{Line: key.Line, Message: fmt.Sprintf("%s: %v", key.Value, err)})
+		}
+	}
+
+	if entry.Text == "" {
+		problems = append(problems, CatalogProblem{Line: node.Line, Message: "entry is missing text"})
+	}
+
+	return entry, problems
+}
+
+func enabledEntries(entries []CatalogEntry) []CatalogEntry {
+	active := make([]CatalogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Enabled {
+			active = append(active, entry)
+		}
+	}
+	return active
+}
+
+func pickWeighted(entries []CatalogEntry, rng *rand.Rand) CatalogEntry {
+	active := enabledEntries(entries)
+
+	total := 0.0
+	for _, entry := range active {
+		total += entry.Weight
+	}
+
+	target := rng.Float64() * total
+	for _, entry := range active {
+		target -= entry.Weight
+		if target < 0 {
+			return entry
+		}
+	}
+	return active[len(active)-1]
+}
+
+func (c *PromptCatalog) PickTheme(rng *rand.Rand) CatalogEntry {
+	return pickWeighted(c.Themes, rng)
+}
+
+func (c *PromptCatalog) PickSituation(rng *rand.Rand) CatalogEntry {
+	return pickWeighted(c.Situations, rng)
+}
+
+func (pg *PromptGenerator) LoadCatalog(path string) error {
+	catalog, err := LoadPromptCatalog(path)
+	if err != nil {
+		return err
+	}
+	pg.SetCatalog(catalog)
+	return nil
+}
+
+func (pg *PromptGenerator) SetCatalog(catalog *PromptCatalog) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.catalog = catalog
+}
+
+func (pg *PromptGenerator) Catalog() *PromptCatalog {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	return pg.catalog
+}
+
+// WatchCatalog loads the catalog once and then polls the file for changes
+// until ctx is cancelled. A broken edit is reported and the last good
+// catalog stays in use.
+func (pg *PromptGenerator) WatchCatalog(ctx context.Context, path string, interval time.Duration) error {
+	if err := pg.LoadCatalog(path); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat catalog: %w", err)
+	}
+	lastModified := info.ModTime()
+	lastSize := info.Size()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Printf("Failed to stat prompt catalog: %v\n", err)
+				continue
+			}
+			if info.ModTime().Equal(lastModified) && info.Size() == lastSize {
+				continue
+			}
+			lastModified = info.ModTime()
+			lastSize = info.Size()
+
+			if err := pg.LoadCatalog(path); err != nil {
+				fmt.Printf("Keeping previous prompt catalog: %v\n", err)
+				continue
+			}
+			fmt.Printf("Reloaded prompt catalog from %s\n", path)
+		}
+	}()
+
+	return nil
+}
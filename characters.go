@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Character struct {
+	ID           string   `yaml:"id" json:"id"`
+	Name         string   `yaml:"name" json:"name"`
+	Breed        string   `yaml:"breed" json:"breed"`
+	Coat         string   `yaml:"coat" json:"coat"`
+	Props        []string `yaml:"props" json:"props,omitempty"`
+	Personality  string   `yaml:"personality" json:"personality"`
+	Catchphrases []string `yaml:"catchphrases" json:"catchphrases,omitempty"`
+}
+
+// CharacterRegistry holds the recurring cat personas and which account
+// owns which cast.
+type CharacterRegistry struct {
+	characters map[string]*Character
+	order      []string
+	casts      map[string][]string
+	mu         sync.RWMutex
+}
+
+type characterFile struct {
+	Characters []*Character        `yaml:"characters"`
+	Casts      map[string][]string `yaml:"casts"`
+}
+
+func NewCharacterRegistry() *CharacterRegistry {
+	return &CharacterRegistry{
+		characters: make(map[string]*Character),
+		casts:      make(map[string][]string),
+	}
+}
+
+func LoadCharacterRegistry(path string) (*CharacterRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read character bible: %w", err)
+	}
+
+	var file characterFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse character bible %s: %w", path, err)
+	}
+
+	registry := NewCharacterRegistry()
+	for _, character := range file.Characters {
+		if err := registry.Add(character); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for accountID, cast := range file.Casts {
+		if err := registry.SetCast(accountID, cast); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return registry, nil
+}
+
+func (r *CharacterRegistry) Add(character *Character) error {
+	if character.ID == "" || character.Name == "" {
+		return fmt.Errorf("character needs an id and a name")
+	}
+	if character.Breed == "" || character.Coat == "" {
+		return fmt.Errorf("character %s needs a breed and coat for visual continuity", character.ID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.characters[character.ID]; exists {
+		return fmt.Errorf("duplicate character id %s", character.ID)
+	}
+	r.characters[character.ID] = character
+	r.order = append(r.order, character.ID)
+	return nil
+}
+
+func (r *CharacterRegistry) SetCast(accountID string, characterIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range characterIDs {
+		if _, ok := r.characters[id]; !ok {
+			return fmt.Errorf("cast for account %s references unknown character %s", accountID, id)
+		}
+	}
+	r.casts[accountID] = characterIDs
+	return nil
+}
+
+func (r *CharacterRegistry) Get(id string) (*Character, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	character, ok := r.characters[id]
+	return character, ok
+}
+
+func (r *CharacterRegistry) Cast(accountID string) []*Character {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cast := make([]*Character, 0, len(r.casts[accountID]))
+	for _, id := range r.casts[accountID] {
+		cast = append(cast, r.characters[id])
+	}
+	return cast
+}
+
+// resolve returns the characters for a request: the explicit IDs if given,
+// otherwise one member of the account's cast so each video has a lead.
+func (r *CharacterRegistry) resolve(req PromptRequest, rng *rand.Rand) ([]*Character, error) {
+	if len(req.CharacterIDs) > 0 {
+		characters := make([]*Character, 0, len(req.CharacterIDs))
+		for _, id := range req.CharacterIDs {
+			character, ok := r.Get(id)
+			if !ok {
+				return nil, fmt.Errorf("unknown character %s", id)
+			}
+			characters = append(characters, character)
+		}
+		return characters, nil
+	}
+
+	cast := r.Cast(req.AccountID)
+	if len(cast) == 0 {
+		return nil, nil
+	}
+	return []*Character{cast[rng.Intn(len(cast))]}, nil
+}
+
+func (r *CharacterRegistry) snapshot() *CharacterSnapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := &CharacterSnapshot{
+		Characters: make([]*Character, 0, len(r.order)),
+		Casts:      make(map[string][]string, len(r.casts)),
+	}
+	for _, id := range r.order {
+		snapshot.Characters = append(snapshot.Characters, r.characters[id])
+	}
+	for accountID, cast := range r.casts {
+		snapshot.Casts[accountID] = cast
+	}
+	return snapshot
+}
+
+func (c *Character) Describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: a %s with %s", c.Name, c.Breed, c.Coat)
+	if len(c.Props) > 0 {
+		fmt.Fprintf(&b, ", always with %s", strings.Join(c.Props, ", "))
+	}
+	if c.Personality != "" {
+		fmt.Fprintf(&b, ". Personality: %s", c.Personality)
+	}
+	if len(c.Catchphrases) > 0 {
+		fmt.Fprintf(&b, ". Catchphrases: \"%s\"", strings.Join(c.Catchphrases, `", "`))
+	}
+	return b.String()
+}
+
+func characterPromptSection(characters []*Character) string {
+	if len(characters) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(characters))
+	for _, character := range characters {
+		lines = append(lines, "- "+character.Describe())
+	}
+	return "\n\nThis video features recurring characters. Keep their look and personality consistent, and spell out breed, coat and props in the video prompt so the video model renders them the same way every time:\n" + strings.Join(lines, "\n")
+}
+
+func characterIDs(characters []*Character) []string {
+	ids := make([]string, 0, len(characters))
+	for _, character := range characters {
+		ids = append(ids, character.ID)
+	}
+	return ids
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxCaptionLength     = 2200
+	maxOnScreenText      = 80
+	maxHashtags          = 30
+	maxShots             = 6
+	maxShotListSeconds   = 8.0 // longest clip any video backend renders
+	maxContentRepairs    = 2
+	contentPackageTokens = 800
+)
+
+var hashtagPattern = regexp.MustCompile(`^#[\p{L}\p{N}_]+$`)
+
+var contentPackageSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "video_prompt": {"type": "string", "description": "1-2 sentence prompt for the video model describing what is on screen"},
+    "negative_prompt": {"type": "string", "description": "comma-separated things the video model should avoid"},
+    "caption": {"type": "string", "description": "Instagram caption that riffs on this specific video"},
+    "hashtags": {"type": "array", "items": {"type": "string"}, "description": "3-10 hashtags including the leading #"},
+    "alt_text": {"type": "string", "description": "plain description of the video for screen readers"},
+    "on_screen_text": {"type": "string", "description": "short text overlay burned into the video, empty for none"},
+    "shot_list": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "description": {"type": "string"},
+          "duration_seconds": {"type": "number"}
+        },
+        "required": ["description", "duration_seconds"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["video_prompt", "negative_prompt", "caption", "hashtags", "alt_text", "on_screen_text", "shot_list"],
+  "additionalProperties": false
+}`)
+
+// requestContentPackage asks the model for a ContentPackage and feeds
+// validation errors back to it until the reply is usable.
+func (pg *PromptGenerator) requestContentPackage(ctx context.Context, req CompletionRequest) (*ContentPackage, *Completion, error) {
+	var pkg *ContentPackage
+	resp, err := pg.requestStructured(ctx, req, &JSONSchema{Name: "content_package", Schema: contentPackageSchema}, func(text string) error {
+		var err error
+		pkg, err = parseContentPackage(text)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	pkg.Language = defaultContentLanguage
+	return pkg, resp, nil
+}
+
+// requestStructured sends req with a JSON schema and passes each reply to
+// parse. Parse errors are sent back to the model, together with the
+// rejected reply, for up to maxContentRepairs more attempts.
+func (pg *PromptGenerator) requestStructured(ctx context.Context, req CompletionRequest, schema *JSONSchema, parse func(text string) error) (*Completion, error) {
+	req.Schema = schema
+	baseUser := req.User
+
+	var lastErr error
+	for attempt := 0; attempt <= maxContentRepairs; attempt++ {
+		resp, err := pg.complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		err = parse(resp.Text)
+		if err == nil {
+			return resp, nil
+		}
+
+		lastErr = err
+		fmt.Printf("%s reply invalid (attempt %d/%d): %v\n", schema.Name, attempt+1, maxContentRepairs+1, err)
+		req.User = fmt.Sprintf("%s\n\nYour previous reply was rejected: %v\nPrevious reply:\n%s\n\nReturn the corrected JSON object only.", baseUser, err, resp.Text)
+	}
+
+	return nil, fmt.Errorf("%s still invalid after %d repairs: %w", schema.Name, maxContentRepairs, lastErr)
+}
+
+func parseContentPackage(text string) (*ContentPackage, error) {
+	var pkg ContentPackage
+	if err := decodeStrictJSON(text, &pkg); err != nil {
+		return nil, fmt.Errorf("reply is not a valid content package JSON object: %w", err)
+	}
+
+	if err := pkg.Validate(); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+func decodeStrictJSON(text string, v interface{}) error {
+	text = strings.TrimSpace(text)
+	// Models without native structured output like to wrap JSON in fences.
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(text, "```")
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// Validate checks the package and normalizes hashtags to a leading '#'.
+func (pkg *ContentPackage) Validate() error {
+	var problems []string
+
+	pkg.VideoPrompt = strings.TrimSpace(pkg.VideoPrompt)
+	pkg.Caption = strings.TrimSpace(pkg.Caption)
+	pkg.AltText = strings.TrimSpace(pkg.AltText)
+	pkg.OnScreenText = strings.TrimSpace(pkg.OnScreenText)
+
+	if pkg.VideoPrompt == "" {
+		problems = append(problems, "video_prompt is empty")
+	}
+	problems = append(problems, validateCaption(pkg.Caption)...)
+	if pkg.AltText == "" {
+		problems = append(problems, "alt_text is empty")
+	}
+	problems = append(problems, validateOnScreenText(pkg.OnScreenText)...)
+	problems = append(problems, normalizeHashtags(pkg.Hashtags)...)
+
+	if len(pkg.ShotList) == 0 || len(pkg.ShotList) > maxShots {
+		problems = append(problems, fmt.Sprintf("shot_list must have 1-%d shots, got %d", maxShots, len(pkg.ShotList)))
+	}
+	total := 0.0
+	for i, shot := range pkg.ShotList {
+		if strings.TrimSpace(shot.Description) == "" {
+			problems = append(problems, fmt.Sprintf("shot %d has no description", i+1))
+		}
+		if shot.DurationSeconds <= 0 {
+			problems = append(problems, fmt.Sprintf("shot %d duration must be positive", i+1))
+		}
+		total += shot.DurationSeconds
+	}
+	if total > maxShotListSeconds {
+		problems = append(problems, fmt.Sprintf("shot list runs %.1fs, limit is %.0fs", total, maxShotListSeconds))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid content package: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateCaption(caption string) []string {
+	if caption == "" {
+		return []string{"caption is empty"}
+	}
+	if length := utf8.RuneCountInString(caption); length > maxCaptionLength {
+		return []string{fmt.Sprintf("caption is %d characters, limit is %d", length, maxCaptionLength)}
+	}
+	return nil
+}
+
+func validateOnScreenText(text string) []string {
+	if length := utf8.RuneCountInString(text); length > maxOnScreenText {
+		return []string{fmt.Sprintf("on_screen_text is %d characters, limit is %d", length, maxOnScreenText)}
+	}
+	return nil
+}
+
+// normalizeHashtags adds missing '#' prefixes in place and reports
+// malformed tags.
+func normalizeHashtags(hashtags []string) []string {
+	var problems []string
+	if len(hashtags) == 0 || len(hashtags) > maxHashtags {
+		problems = append(problems, fmt.Sprintf("hashtags must have 1-%d entries, got %d", maxHashtags, len(hashtags)))
+	}
+	for i, tag := range hashtags {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, "#") {
+			tag = "#" + tag
+		}
+		if !hashtagPattern.MatchString(tag) {
+			problems = append(problems, fmt.Sprintf("hashtag %q must be a single word of letters, digits or underscores", hashtags[i]))
+		}
+		hashtags[i] = tag
+	}
+	return problems
+}
+
+func (pkg *ContentPackage) CaptionWithHashtags() string {
+	return joinCaption(pkg.Caption, pkg.Hashtags)
+}
+
+func joinCaption(caption string, hashtags []string) string {
+	if len(hashtags) == 0 {
+		return caption
+	}
+	return caption + "\n\n" + strings.Join(hashtags, " ")
+}
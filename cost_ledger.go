@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type SpendKind string
+
+const (
+	SpendVideo  SpendKind = "video"
+	SpendTokens SpendKind = "tokens"
+)
+
+// SpendEntry is one billed request. Item is the video provider or the
+// prompt model name.
+type SpendEntry struct {
+	Time             time.Time `json:"time"`
+	Group            string    `json:"group"`
+	AccountID        string    `json:"account_id,omitempty"`
+	Kind             SpendKind `json:"kind"`
+	Item             string    `json:"item"`
+	PromptID         string    `json:"prompt_id,omitempty"`
+	Seconds          int       `json:"seconds,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	Cost             float64   `json:"cost_usd"`
+}
+
+// CostLedger is an append-only JSON Lines log of spend, kept in memory so
+// budget checks do not reread the file.
+type CostLedger struct {
+	path    string
+	entries []SpendEntry
+	mu      sync.RWMutex
+}
+
+func LoadCostLedger(path string) (*CostLedger, error) {
+	l := &CostLedger{path: path}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cost ledger: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry SpendEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode cost ledger line %d: %w", line, err)
+		}
+		l.entries = append(l.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cost ledger: %w", err)
+	}
+
+	return l, nil
+}
+
+func (l *CostLedger) Path() string {
+	return l.path
+}
+
+func (l *CostLedger) Add(entry SpendEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode spend entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if dir := filepath.Dir(l.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create cost ledger directory: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open cost ledger: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append cost ledger: %w", err)
+	}
+
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+// Since returns the entries recorded at or after t, oldest first.
+func (l *CostLedger) Since(t time.Time) []SpendEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var entries []SpendEntry
+	for _, entry := range l.entries {
+		if !entry.Time.Before(t) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Spent totals a group's spend since t.
+func (l *CostLedger) Spent(group string, since time.Time) float64 {
+	total := 0.0
+	for _, entry := range l.Since(since) {
+		if entry.Group == group {
+			total += entry.Cost
+		}
+	}
+	return total
+}
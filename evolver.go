@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EvolutionConfig struct {
+	Offspring     int
+	Parents       int
+	CrossoverRate float64
+}
+
+// PromptEvolver breeds new prompts from the prompts behind the best
+// performing posts. Offspring keep their parents' catalog theme and
+// situation, so the bandit keeps crediting the same arms, and record their
+// lineage so evolved prompts can be compared with random ones. Offspring
+// pass the same novelty gate as other prompts and are added to the history
+// through it.
+type PromptEvolver struct {
+	pg      *PromptGenerator
+	tracker *PerformanceTracker
+	novelty *NoveltyChecker
+	config  EvolutionConfig
+}
+
+func NewEvolutionConfigFromEnv() (EvolutionConfig, error) {
+	config := EvolutionConfig{
+		Offspring:     3,
+		Parents:       5,
+		CrossoverRate: 0.5,
+	}
+
+	if value := os.Getenv("EVOLVE_OFFSPRING"); value != "" {
+		offspring, err := strconv.Atoi(value)
+		if err != nil || offspring <= 0 {
+			return config, fmt.Errorf("EVOLVE_OFFSPRING must be a positive integer, got %q", value)
+		}
+		config.Offspring = offspring
+	}
+
+	if value := os.Getenv("EVOLVE_PARENTS"); value != "" {
+		parents, err := strconv.Atoi(value)
+		if err != nil || parents <= 0 {
+			return config, fmt.Errorf("EVOLVE_PARENTS must be a positive integer, got %q", value)
+		}
+		config.Parents = parents
+	}
+
+	if value := os.Getenv("EVOLVE_CROSSOVER_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return config, fmt.Errorf("EVOLVE_CROSSOVER_RATE must be in [0, 1], got %q", value)
+		}
+		config.CrossoverRate = rate
+	}
+
+	return config, nil
+}
+
+func NewPromptEvolver(pg *PromptGenerator, tracker *PerformanceTracker, novelty *NoveltyChecker, config EvolutionConfig) *PromptEvolver {
+	return &PromptEvolver{
+		pg:      pg,
+		tracker: tracker,
+		novelty: novelty,
+		config:  config,
+	}
+}
+
+// Parents returns the prompts behind the best performing posts, best
+// first. Posts whose prompt is not in the history are skipped.
+func (ev *PromptEvolver) Parents() []PromptRecord {
+	parents := make([]PromptRecord, 0, ev.config.Parents)
+	seen := make(map[string]bool)
+
+	// Several posts can share a prompt, so look further than Parents.
+	for _, post := range ev.tracker.GetBestPerformingPosts(ev.config.Parents * 3) {
+		if post.PromptID == "" || seen[post.PromptID] {
+			continue
+		}
+		seen[post.PromptID] = true
+
+		if record, ok := ev.novelty.history.Get(post.PromptID); ok {
+			parents = append(parents, record)
+			if len(parents) == ev.config.Parents {
+				break
+			}
+		}
+	}
+	return parents
+}
+
+// Evolve produces count offspring for req's account, each either a
+// mutation of one parent or a crossover of two. Each offspring draws its
+// parents and characters from its own seed and is logged to the current
+// run with the parent pool it drew from, so replay can repeat the draw.
+func (ev *PromptEvolver) Evolve(ctx context.Context, count int, req PromptRequest) ([]*VideoPrompt, error) {
+	parents := ev.Parents()
+	if len(parents) == 0 {
+		return nil, fmt.Errorf("no top posts with a known prompt to evolve from")
+	}
+
+	evolution := &RunEvolution{
+		CrossoverRate: ev.config.CrossoverRate,
+		Parents:       make([]EvolutionParent, 0, len(parents)),
+	}
+	records := make(map[string]PromptRecord, len(parents))
+	for _, parent := range parents {
+		evolution.Parents = append(evolution.Parents, EvolutionParent{ID: parent.ID, Theme: parent.Theme, Situation: parent.Situation})
+		records[parent.ID] = parent
+	}
+
+	offspring := make([]*VideoPrompt, 0, count)
+	for i := 0; i < count; i++ {
+		child, err := ev.evolve(ctx, req, newPromptDraw(ev.pg.nextSeed()), evolution, records)
+		if err != nil {
+			if ctx.Err() != nil {
+				return offspring, ctx.Err()
+			}
+			fmt.Printf("Failed to evolve prompt %d: %v\n", i+1, err)
+			continue
+		}
+		offspring = append(offspring, child)
+	}
+
+	return offspring, nil
+}
+
+func (ev *PromptEvolver) evolve(ctx context.Context, req PromptRequest, draw *promptDraw, evolution *RunEvolution, records map[string]PromptRecord) (*VideoPrompt, error) {
+	ev.pg.mu.RLock()
+	run := ev.pg.run
+	ev.pg.mu.RUnlock()
+
+	prompt, err := ev.novelty.admitNovel(ctx, func() (*VideoPrompt, error) {
+		return ev.breed(ctx, req, draw, evolution, records)
+	})
+	if err != nil {
+		return nil, err
+	}
+	prompt = ev.pg.recordPrompt(prompt)
+
+	draw.evolution = evolution
+	if run != nil {
+		if err := run.Record(prompt, req, draw); err != nil {
+			fmt.Printf("Failed to record prompt in run log: %v\n", err)
+		}
+	}
+	return prompt, nil
+}
+
+// selectParents picks the parents of one offspring attempt from the pool
+// and records the choice on the draw. A mutation keeps its parent's theme
+// and situation; a crossover takes the first parent's theme and the
+// second's situation.
+func (pg *PromptGenerator) selectParents(req PromptRequest, draw *promptDraw, evolution *RunEvolution) (PromptSelection, []*Character, error) {
+	pool := evolution.Parents
+	if len(pool) == 0 {
+		return PromptSelection{}, nil, fmt.Errorf("no parents to evolve from")
+	}
+
+	var chosen []EvolutionParent
+	if len(pool) >= 2 && draw.rng.Float64() < evolution.CrossoverRate {
+		a := draw.rng.Intn(len(pool))
+		b := draw.rng.Intn(len(pool) - 1)
+		if b >= a {
+			b++
+		}
+		chosen = []EvolutionParent{pool[a], pool[b]}
+	} else {
+		chosen = []EvolutionParent{pool[draw.rng.Intn(len(pool))]}
+	}
+
+	characters, err := pg.resolveCharacters(req, draw.rng)
+	if err != nil {
+		return PromptSelection{}, nil, err
+	}
+
+	parentIDs := make([]string, 0, len(chosen))
+	for _, parent := range chosen {
+		parentIDs = append(parentIDs, parent.ID)
+	}
+
+	selection := PromptSelection{
+		Theme:      chosen[0].Theme,
+		Situation:  chosen[len(chosen)-1].Situation,
+		Characters: characterIDs(characters),
+		ParentIDs:  parentIDs,
+	}
+	draw.selections = append(draw.selections, selection)
+	return selection, characters, nil
+}
+
+const evolutionSystemPrompt = "You are a creative director for post-ironic cat content who breeds new video ideas from proven winners. Keep what made the originals work (the core joke, the pacing, the meta wink) while producing something viewers have not seen before. Keep it weird but family-friendly. Every video ships as a content package: the video prompt, what the video model must avoid, an Instagram caption and hashtags written for this exact video, alt text, and a short shot list that fits in 8 seconds."
+
+func mutationPrompt(parent PromptRecord) string {
+	return fmt.Sprintf("This video performed well:\n%s\n\nIts theme was \"%s\" and the cat %s. Keep the theme, but twist the situation: change one concrete element (the object, the setting, the stakes or the cat's reaction) so the joke lands in a new way.",
+		parent.Text, parent.Theme, parent.Situation)
+}
+
+func crossoverPrompt(a, b PromptRecord) string {
+	return fmt.Sprintf("These two videos both performed well:\n\nA: %s\n(theme \"%s\", the cat %s)\n\nB: %s\n(theme \"%s\", the cat %s)\n\nMerge them into one new video that deals with A's theme while the cat %s, borrowing the strongest visual gag from each.",
+		a.Text, a.Theme, a.Situation, b.Text, b.Theme, b.Situation, b.Situation)
+}
+
+func (ev *PromptEvolver) breed(ctx context.Context, req PromptRequest, draw *promptDraw, evolution *RunEvolution, records map[string]PromptRecord) (*VideoPrompt, error) {
+	selection, characters, err := ev.pg.selectParents(req, draw, evolution)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make([]PromptRecord, 0, len(selection.ParentIDs))
+	generation := 0
+	for _, id := range selection.ParentIDs {
+		parent := records[id]
+		parents = append(parents, parent)
+		if parent.Generation > generation {
+			generation = parent.Generation
+		}
+	}
+
+	var userPrompt string
+	if len(parents) == 2 {
+		userPrompt = crossoverPrompt(parents[0], parents[1])
+	} else {
+		userPrompt = mutationPrompt(parents[0])
+	}
+
+	systemPrompt := evolutionSystemPrompt + characterPromptSection(characters)
+	if len(characters) > 0 {
+		userPrompt += fmt.Sprintf(" The cat is %s.", characters[0].Name)
+	}
+
+	completionReq := CompletionRequest{
+		System:      systemPrompt,
+		User:        userPrompt,
+		MaxTokens:   contentPackageTokens,
+		Temperature: 0.9,
+		Seed:        draw.seed,
+		AccountID:   req.AccountID,
+	}
+	pkg, _, err := ev.pg.requestContentPackage(ctx, completionReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VideoPrompt{
+		ID:          uuid.New().String(),
+		Text:        pkg.VideoPrompt,
+		Theme:       selection.Theme,
+		Situation:   selection.Situation,
+		Model:       ev.pg.model.Name(),
+		Source:      PromptSourceEvolved,
+		AccountID:   req.AccountID,
+		Characters:  selection.Characters,
+		ParentIDs:   selection.ParentIDs,
+		Generation:  generation + 1,
+		Seed:        draw.seed,
+		ModelParams: modelParamsFor(completionReq),
+		Content:     pkg,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+type GenerationStats struct {
+	Generation     int     `json:"generation"`
+	Posts          int     `json:"posts"`
+	EngagementRate float64 `json:"engagement_rate"`
+}
+
+// EngagementByGeneration groups post engagement by the generation of the
+// prompt behind it. Generation 0 is plain catalog sampling, so comparing
+// it with later generations shows whether evolution pays off.
+func (pt *PerformanceTracker) EngagementByGeneration(history *PromptHistory) []GenerationStats {
+	pt.mu.RLock()
+	generations := make(map[int]*GenerationStats)
+	for _, perf := range pt.performances {
+		record, ok := history.Get(perf.PromptID)
+		if !ok {
+			continue
+		}
+		stats, exists := generations[record.Generation]
+		if !exists {
+			stats = &GenerationStats{Generation: record.Generation}
+			generations[record.Generation] = stats
+		}
+		stats.Posts++
+		stats.EngagementRate += perf.EngagementRate
+	}
+	pt.mu.RUnlock()
+
+	result := make([]GenerationStats, 0, len(generations))
+	for _, stats := range generations {
+		stats.EngagementRate /= float64(stats.Posts)
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Generation < result[j].Generation
+	})
+	return result
+}
@@ -8,29 +8,117 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 )
 
 type InstagramPoster struct {
-	accounts []InstagramAccount
-	client   *http.Client
+	accounts      []InstagramAccount
+	client        *http.Client
+	postProcessor *PostProcessor
+	postLog       *PostLog
+	assets        *AssetStore
+	rng           *rand.Rand
+	mu            sync.Mutex
+}
+
+// InstagramAccountsFromEnv returns the two test accounts and the main
+// account, with tokens and locales from INSTA_TOKEN_* and INSTA_LOCALE_*.
+func InstagramAccountsFromEnv() []InstagramAccount {
+	return []InstagramAccount{
+		{
+			ID:            "test1",
+			Username:      "cat_vibes_1",
+			AccessToken:   os.Getenv("INSTA_TOKEN_1"),
+			Locale:        os.Getenv("INSTA_LOCALE_1"),
+			IsMainAccount: false,
+			IsActive:      true,
+		},
+		{
+			ID:            "test2",
+			Username:      "cat_vibes_2",
+			AccessToken:   os.Getenv("INSTA_TOKEN_2"),
+			Locale:        os.Getenv("INSTA_LOCALE_2"),
+			IsMainAccount: false,
+			IsActive:      true,
+		},
+		{
+			ID:            "main",
+			Username:      "main_cat_account",
+			AccessToken:   os.Getenv("INSTA_TOKEN_MAIN"),
+			Locale:        os.Getenv("INSTA_LOCALE_MAIN"),
+			IsMainAccount: true,
+			IsActive:      true,
+		},
+	}
 }
 
 func NewInstagramPoster(accounts []InstagramAccount) *InstagramPoster {
 	return &InstagramPoster{
 		accounts: accounts,
 		client:   &http.Client{Timeout: 30 * time.Second},
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// SetSeed makes fallback captions repeatable.
+func (ip *InstagramPoster) SetSeed(seed int64) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	ip.rng = rand.New(rand.NewSource(seed))
+}
+
+// SetPostProcessor runs each account's post-processing pipeline on a
+// video before it is posted there.
+func (ip *InstagramPoster) SetPostProcessor(postProcessor *PostProcessor) {
+	ip.postProcessor = postProcessor
+}
+
+// SetPostLog records every published post in postLog, so a later run can
+// measure its performance and credit it to the prompt behind it.
+func (ip *InstagramPoster) SetPostLog(postLog *PostLog) {
+	ip.postLog = postLog
+}
+
+// SetAssetStore posts stored videos from the store's public URL instead
+// of the provider URL, which may have expired.
+func (ip *InstagramPoster) SetAssetStore(assets *AssetStore) {
+	ip.assets = assets
+}
+
 func (ip *InstagramPoster) PostToAccount(ctx context.Context, video *GeneratedVideo, account *InstagramAccount) (string, error) {
 	fmt.Printf("Posting video %s to @%s\n", video.ID, account.Username)
 
+	if ip.postProcessor != nil {
+		processed, err := ip.postProcessor.Process(ctx, video, account)
+		if err != nil {
+			return "", fmt.Errorf("post-processing failed: %w", err)
+		}
+		video = processed
+	}
+
+	// Videos that could not be inspected are left to Instagram to reject.
+	if video.Metadata != nil {
+		check := CheckReels(video.Metadata)
+		if err := check.Err(); err != nil {
+			return "", err
+		}
+		for _, warning := range check.Warnings {
+			fmt.Printf("Warning: video %s: %s\n", video.ID, warning)
+		}
+	}
+
+	videoURL, err := ip.videoURL(video)
+	if err != nil {
+		return "", err
+	}
+
 	// Step 1: Upload media
 	mediaPayload := map[string]interface{}{
-		"video_url":  video.VideoURL,
+		"video_url":  videoURL,
 		"media_type": "REELS",
-		"caption":    ip.generateCaption(),
+		"caption":    ip.generateCaption(video, account),
 	}
 
 	mediaURL := fmt.Sprintf("https://graph.instagram.com/v18.0/%s/media", account.ID)
@@ -60,9 +148,38 @@ func (ip *InstagramPoster) PostToAccount(ctx context.Context, video *GeneratedVi
 		return "", fmt.Errorf("invalid post ID response")
 	}
 
+	if ip.postLog != nil {
+		record := PostRecord{
+			PostID:    postID,
+			AccountID: account.ID,
+			PromptID:  video.PromptID,
+			VideoID:   video.ID,
+			PostedAt:  time.Now(),
+		}
+		if err := ip.postLog.Add(record); err != nil {
+			fmt.Printf("Failed to record post %s: %v\n", postID, err)
+		}
+	}
 	return postID, nil
 }
 
+// videoURL returns the URL Instagram fetches the video from. Stored videos
+// are posted from the asset store, since provider URLs expire; a stored
+// video without a public URL, or a provider URL that needs the provider's
+// credentials, is refused rather than handed to Instagram.
+func (ip *InstagramPoster) videoURL(video *GeneratedVideo) (string, error) {
+	if video.AssetSHA256 != "" {
+		if ip.assets == nil || ip.assets.PublicURL() == "" {
+			return "", fmt.Errorf("video %s is stored as asset %s but the asset store has no public URL, set ASSET_PUBLIC_URL to post it", video.ID, video.AssetSHA256)
+		}
+		return ip.assets.URL(video.AssetSHA256), nil
+	}
+	if spec, ok := LookupVideoBackend(video.Provider); ok && spec.PrivateURLs {
+		return "", fmt.Errorf("%s video URLs need provider credentials, set ASSET_STORE and ASSET_PUBLIC_URL to post them", video.Provider)
+	}
+	return video.VideoURL, nil
+}
+
 func (ip *InstagramPoster) PostToTestAccounts(ctx context.Context, video *GeneratedVideo) ([]string, error) {
 	var testAccounts []InstagramAccount
 	for _, account := range ip.accounts {
@@ -76,15 +193,43 @@ func (ip *InstagramPoster) PostToTestAccounts(ctx context.Context, video *Genera
 		postID, err := ip.PostToAccount(ctx, video, &account)
 		if err != nil {
 			fmt.Printf("Failed to post to @%s: %v\n", account.Username, err)
-			// Generate mock post ID for testing
-			postID = fmt.Sprintf("mock_post_%d", time.Now().Unix())
+			continue
 		}
 		postIDs = append(postIDs, postID)
 	}
 
+	if len(postIDs) == 0 && len(testAccounts) > 0 {
+		return nil, fmt.Errorf("failed to post to any of %d test accounts", len(testAccounts))
+	}
 	return postIDs, nil
 }
 
+// MeasurePosts fetches the performance of logged posts, attributed to the
+// prompt behind each, and logs it so no post is counted twice. Posts that
+// cannot be fetched are logged and left for the next run.
+func (ip *InstagramPoster) MeasurePosts(ctx context.Context, records []PostRecord) []PostPerformance {
+	performances := make([]PostPerformance, 0, len(records))
+	for _, record := range records {
+		performance, err := ip.GetPostPerformance(ctx, record.PostID, record.AccountID)
+		if err != nil {
+			fmt.Printf("Failed to fetch performance of post %s: %v\n", record.PostID, err)
+			continue
+		}
+		performance.PromptID = record.PromptID
+		performance.PostedAt = record.PostedAt
+
+		record.Performance = performance
+		if ip.postLog != nil {
+			if err := ip.postLog.Add(record); err != nil {
+				fmt.Printf("Failed to record performance of post %s: %v\n", record.PostID, err)
+				continue
+			}
+		}
+		performances = append(performances, *performance)
+	}
+	return performances
+}
+
 func (ip *InstagramPoster) GetPostPerformance(ctx context.Context, postID, accountID string) (*PostPerformance, error) {
 	var account *InstagramAccount
 	for _, acc := range ip.accounts {
@@ -112,17 +257,8 @@ func (ip *InstagramPoster) GetPostPerformance(ctx context.Context, postID, accou
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		// Return mock data for testing
-		return &PostPerformance{
-			PostID:         postID,
-			AccountID:      accountID,
-			Likes:          rand.Intn(100),
-			Comments:       rand.Intn(20),
-			Shares:         rand.Intn(10),
-			Views:          rand.Intn(1000),
-			EngagementRate: rand.Float64() * 0.1,
-			PostedAt:       time.Now(),
-		}, nil
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("performance request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	var data map[string]interface{}
@@ -182,7 +318,12 @@ func (ip *InstagramPoster) makeInstagramRequest(ctx context.Context, method, url
 	return result, nil
 }
 
-func (ip *InstagramPoster) generateCaption() string {
+func (ip *InstagramPoster) generateCaption(video *GeneratedVideo, account *InstagramAccount) string {
+	if video.Content != nil && video.Content.Caption != "" {
+		content := video.Content.ForLocale(account.Locale)
+		return content.CaptionWithHashtags()
+	}
+
 	captions := []string{
 		"this is fine",
 		"pov: you're a cat in 2024",
@@ -194,7 +335,9 @@ func (ip *InstagramPoster) generateCaption() string {
 		"this but unironically",
 	}
 
-	return captions[rand.Intn(len(captions))]
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	return captions[ip.rng.Intn(len(captions))]
 }
 
 func (ip *InstagramPoster) getIntFromResponse(data map[string]interface{}, key string) int {
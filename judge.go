@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	judgeTokens   = 400
+	minRubricMark = 1
+	maxRubricMark = 10
+)
+
+// PromptScore is the judge's rubric for one prompt. Each criterion is
+// marked 1-10; Overall is their weighted mean.
+type PromptScore struct {
+	Absurdity     float64   `json:"absurdity"`
+	VisualClarity float64   `json:"visual_clarity"`
+	Feasibility   float64   `json:"feasibility"`
+	BrandFit      float64   `json:"brand_fit"`
+	Overall       float64   `json:"overall"`
+	Rationale     string    `json:"rationale"`
+	Judge         string    `json:"judge"`
+	ScoredAt      time.Time `json:"scored_at"`
+}
+
+type JudgeConfig struct {
+	TopK       int
+	BrandGuide string
+	LogPath    string
+	Weights    RubricWeights
+}
+
+type RubricWeights struct {
+	Absurdity     float64
+	VisualClarity float64
+	Feasibility   float64
+	BrandFit      float64
+}
+
+// JudgeRecord is one line of the judge log, kept so scores can later be
+// compared with the engagement the posted video actually got.
+type JudgeRecord struct {
+	PromptID string      `json:"prompt_id"`
+	Text     string      `json:"text"`
+	Score    PromptScore `json:"score"`
+	Selected bool        `json:"selected"`
+}
+
+// PromptJudge scores candidate prompts with the prompt model and forwards
+// only the best ones, so video credits are spent on the strongest ideas.
+type PromptJudge struct {
+	pg     *PromptGenerator
+	config JudgeConfig
+	mu     sync.Mutex
+}
+
+var promptScoreSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "absurdity": {"type": "number", "description": "1-10, how surprising and funny the premise is"},
+    "visual_clarity": {"type": "number", "description": "1-10, how clearly a viewer gets the joke without sound or caption"},
+    "feasibility": {"type": "number", "description": "1-10, how likely an 8 second AI video model renders it convincingly"},
+    "brand_fit": {"type": "number", "description": "1-10, how well it matches the brand guide"},
+    "rationale": {"type": "string", "description": "one or two sentences explaining the marks"}
+  },
+  "required": ["absurdity", "visual_clarity", "feasibility", "brand_fit", "rationale"],
+  "additionalProperties": false
+}`)
+
+func DefaultJudgeConfig() JudgeConfig {
+	return JudgeConfig{
+		TopK:       3,
+		BrandGuide: "Post-ironic, slightly meta cat content that mixes internet culture with real cat behaviour. Weird but always family-friendly.",
+		Weights: RubricWeights{
+			Absurdity:     1,
+			VisualClarity: 1,
+			Feasibility:   1,
+			BrandFit:      1,
+		},
+	}
+}
+
+func NewJudgeConfigFromEnv() (JudgeConfig, error) {
+	config := DefaultJudgeConfig()
+
+	if value := os.Getenv("JUDGE_TOP_K"); value != "" {
+		topK, err := strconv.Atoi(value)
+		if err != nil || topK <= 0 {
+			return config, fmt.Errorf("JUDGE_TOP_K must be a positive integer, got %q", value)
+		}
+		config.TopK = topK
+	}
+
+	if path := os.Getenv("JUDGE_BRAND_GUIDE_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("failed to read brand guide: %w", err)
+		}
+		config.BrandGuide = strings.TrimSpace(string(data))
+	}
+
+	config.LogPath = os.Getenv("JUDGE_LOG_PATH")
+	return config, nil
+}
+
+func NewPromptJudge(pg *PromptGenerator, config JudgeConfig) *PromptJudge {
+	return &PromptJudge{pg: pg, config: config}
+}
+
+func (pj *PromptJudge) Score(ctx context.Context, prompt *VideoPrompt) (*PromptScore, error) {
+	systemPrompt := fmt.Sprintf("You are a strict judge for short AI-generated cat videos. Video generation is expensive, so be critical and use the whole 1-10 range. Mark the candidate on absurdity, visual clarity, feasibility for an 8 second AI video model, and brand fit.\n\nBrand guide: %s", pj.config.BrandGuide)
+
+	userPrompt := "Video prompt: " + prompt.Text
+	if prompt.Content != nil && len(prompt.Content.ShotList) > 0 {
+		shots := make([]string, 0, len(prompt.Content.ShotList))
+		for _, shot := range prompt.Content.ShotList {
+			shots = append(shots, fmt.Sprintf("- %s (%.1fs)", shot.Description, shot.DurationSeconds))
+		}
+		userPrompt += "\nShot list:\n" + strings.Join(shots, "\n")
+	}
+
+	var score *PromptScore
+	_, err := pj.pg.requestStructured(ctx, CompletionRequest{
+		System:      systemPrompt,
+		User:        userPrompt,
+		MaxTokens:   judgeTokens,
+		Temperature: 0.2,
+		AccountID:   prompt.AccountID,
+	}, &JSONSchema{Name: "prompt_score", Schema: promptScoreSchema}, func(text string) error {
+		var err error
+		score, err = parsePromptScore(text)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to score prompt %s: %w", prompt.ID, err)
+	}
+
+	score.Overall = pj.config.Weights.overall(score)
+	score.Judge = pj.pg.model.Name()
+	score.ScoredAt = time.Now()
+	return score, nil
+}
+
+func parsePromptScore(text string) (*PromptScore, error) {
+	var score PromptScore
+	if err := decodeStrictJSON(text, &score); err != nil {
+		return nil, fmt.Errorf("reply is not a valid prompt score JSON object: %w", err)
+	}
+
+	var problems []string
+	for name, mark := range map[string]float64{
+		"absurdity":      score.Absurdity,
+		"visual_clarity": score.VisualClarity,
+		"feasibility":    score.Feasibility,
+		"brand_fit":      score.BrandFit,
+	} {
+		if mark < minRubricMark || mark > maxRubricMark {
+			problems = append(problems, fmt.Sprintf("%s must be %d-%d, got %g", name, minRubricMark, maxRubricMark, mark))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid prompt score: %s", strings.Join(problems, "; "))
+	}
+	return &score, nil
+}
+
+func (w RubricWeights) overall(score *PromptScore) float64 {
+	total := w.Absurdity + w.VisualClarity + w.Feasibility + w.BrandFit
+	if total <= 0 {
+		return 0
+	}
+	return (score.Absurdity*w.Absurdity +
+		score.VisualClarity*w.VisualClarity +
+		score.Feasibility*w.Feasibility +
+		score.BrandFit*w.BrandFit) / total
+}
+
+// SelectTop scores every prompt, records the score on it and returns the
+// TopK highest scoring ones. Prompts the judge could not score are not
+// forwarded.
+func (pj *PromptJudge) SelectTop(ctx context.Context, prompts []*VideoPrompt) ([]*VideoPrompt, error) {
+	pj.pg.mu.RLock()
+	workers := pj.pg.batch.Workers
+	pj.pg.mu.RUnlock()
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, prompt := range prompts {
+		wg.Add(1)
+		go func(prompt *VideoPrompt) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			score, err := pj.Score(ctx, prompt)
+			if err != nil {
+				fmt.Printf("Judge skipped prompt %s: %v\n", prompt.ID, err)
+				return
+			}
+			prompt.Score = score
+		}(prompt)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	scored := make([]*VideoPrompt, 0, len(prompts))
+	for _, prompt := range prompts {
+		if prompt.Score != nil {
+			scored = append(scored, prompt)
+		}
+	}
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].Score.Overall > scored[j].Score.Overall
+	})
+
+	selected := scored
+	if len(selected) > pj.config.TopK {
+		selected = selected[:pj.config.TopK]
+	}
+
+	if err := pj.log(scored, len(selected)); err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+// SelectTopPerAccount runs SelectTop over each account's prompts on its
+// own, so every account keeps up to TopK prompts however the others score.
+func (pj *PromptJudge) SelectTopPerAccount(ctx context.Context, prompts []*VideoPrompt) ([]*VideoPrompt, error) {
+	var accounts []string
+	byAccount := make(map[string][]*VideoPrompt)
+	for _, prompt := range prompts {
+		if _, ok := byAccount[prompt.AccountID]; !ok {
+			accounts = append(accounts, prompt.AccountID)
+		}
+		byAccount[prompt.AccountID] = append(byAccount[prompt.AccountID], prompt)
+	}
+
+	selected := make([]*VideoPrompt, 0, len(prompts))
+	for _, accountID := range accounts {
+		top, err := pj.SelectTop(ctx, byAccount[accountID])
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, top...)
+	}
+	return selected, nil
+}
+
+func (pj *PromptJudge) log(ranked []*VideoPrompt, selected int) error {
+	if pj.config.LogPath == "" || len(ranked) == 0 {
+		return nil
+	}
+
+	pj.mu.Lock()
+	defer pj.mu.Unlock()
+
+	if dir := filepath.Dir(pj.config.LogPath); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create judge log directory: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(pj.config.LogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open judge log: %w", err)
+	}
+	defer file.Close()
+
+	for i, prompt := range ranked {
+		data, err := json.Marshal(JudgeRecord{
+			PromptID: prompt.ID,
+			Text:     prompt.Text,
+			Score:    *prompt.Score,
+			Selected: i < selected,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode judge record: %w", err)
+		}
+		if _, err := file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to append judge log: %w", err)
+		}
+	}
+	return nil
+}
+
+func LoadJudgeLog(path string) ([]JudgeRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open judge log: %w", err)
+	}
+	defer file.Close()
+
+	var records []JudgeRecord
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record JudgeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode judge log line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read judge log: %w", err)
+	}
+	return records, nil
+}
+
+// JudgeCalibration is the Pearson correlation between each rubric
+// criterion and the engagement rate of the posts that were published.
+type JudgeCalibration struct {
+	Samples       int     `json:"samples"`
+	Absurdity     float64 `json:"absurdity"`
+	VisualClarity float64 `json:"visual_clarity"`
+	Feasibility   float64 `json:"feasibility"`
+	BrandFit      float64 `json:"brand_fit"`
+	Overall       float64 `json:"overall"`
+}
+
+func (pt *PerformanceTracker) JudgeCalibration(records []JudgeRecord) JudgeCalibration {
+	scores := make(map[string]PromptScore, len(records))
+	for _, record := range records {
+		scores[record.PromptID] = record.Score
+	}
+
+	var matched []PromptScore
+	var engagement []float64
+	pt.mu.RLock()
+	for _, perf := range pt.performances {
+		if score, ok := scores[perf.PromptID]; ok {
+			matched = append(matched, score)
+			engagement = append(engagement, perf.EngagementRate)
+		}
+	}
+	pt.mu.RUnlock()
+
+	criterion := func(mark func(PromptScore) float64) float64 {
+		values := make([]float64, len(matched))
+		for i, score := range matched {
+			values[i] = mark(score)
+		}
+		return pearson(values, engagement)
+	}
+
+	return JudgeCalibration{
+		Samples:       len(matched),
+		Absurdity:     criterion(func(s PromptScore) float64 { return s.Absurdity }),
+		VisualClarity: criterion(func(s PromptScore) float64 { return s.VisualClarity }),
+		Feasibility:   criterion(func(s PromptScore) float64 { return s.Feasibility }),
+		BrandFit:      criterion(func(s PromptScore) float64 { return s.BrandFit }),
+		Overall:       criterion(func(s PromptScore) float64 { return s.Overall }),
+	}
+}
+
+func pearson(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	if len(xs) < 2 || len(xs) != len(ys) {
+		return 0
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	var cov, varX, varY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varX*varY)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+func judgeReport() {
+	judgeLogPath := os.Getenv("JUDGE_LOG_PATH")
+	if judgeLogPath == "" {
+		log.Fatalf("JUDGE_LOG_PATH must point at the judge log to report on")
+	}
+	records, err := LoadJudgeLog(judgeLogPath)
+	if err != nil {
+		log.Fatalf("Failed to load judge log: %v", err)
+	}
+
+	postLog, err := NewPostLogFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid post log config: %v", err)
+	}
+	if postLog == nil {
+		log.Fatalf("POST_LOG_PATH or PROMPT_HISTORY_PATH must locate the post log to correlate with")
+	}
+
+	// Posts that have settled since the last run are measured now, so the
+	// report covers everything that can be measured.
+	poster := NewInstagramPoster(InstagramAccountsFromEnv())
+	poster.SetPostLog(postLog)
+	tracker := NewPerformanceTracker()
+	tracker.Restore(postLog.Performances())
+	measured := poster.MeasurePosts(context.Background(), postLog.Due(time.Now()))
+	for _, performance := range measured {
+		tracker.AddPerformance(performance)
+	}
+
+	calibration := tracker.JudgeCalibration(records)
+	fmt.Printf("⚖️  Judge calibration (%d scored prompts, %d newly measured posts)\n", len(records), len(measured))
+	if calibration.Samples < 2 {
+		fmt.Printf("Only %d measured posts have a judge score, need at least 2 to correlate\n", calibration.Samples)
+		return
+	}
+
+	fmt.Printf("Pearson correlation with engagement rate over %d posts:\n", calibration.Samples)
+	fmt.Printf("   absurdity:      %+.2f\n", calibration.Absurdity)
+	fmt.Printf("   visual clarity: %+.2f\n", calibration.VisualClarity)
+	fmt.Printf("   feasibility:    %+.2f\n", calibration.Feasibility)
+	fmt.Printf("   brand fit:      %+.2f\n", calibration.BrandFit)
+	fmt.Printf("   overall:        %+.2f\n", calibration.Overall)
+}
+
+func init() {
+	// go run ... judge-report correlates judge scores with engagement
+	if len(os.Args) > 1 && os.Args[1] == "judge-report" {
+		judgeReport()
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultContentLanguage is the language content packages are written in.
+// Video prompts always stay in it because video models follow English
+// prompts best.
+const defaultContentLanguage = "en"
+
+// LocalizedContent is the viewer-facing part of a ContentPackage rewritten
+// for one locale.
+type LocalizedContent struct {
+	Language     string   `json:"language"`
+	Caption      string   `json:"caption"`
+	Hashtags     []string `json:"hashtags"`
+	AltText      string   `json:"alt_text"`
+	OnScreenText string   `json:"on_screen_text"`
+}
+
+var localizedContentSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "caption": {"type": "string", "description": "caption written natively for the target audience"},
+    "hashtags": {"type": "array", "items": {"type": "string"}, "description": "3-10 hashtags people in the target market actually use, including the leading #"},
+    "alt_text": {"type": "string", "description": "plain description of the video for screen readers, in the target language"},
+    "on_screen_text": {"type": "string", "description": "the on-screen text in the target language, empty if the original is empty"}
+  },
+  "required": ["caption", "hashtags", "alt_text", "on_screen_text"],
+  "additionalProperties": false
+}`)
+
+// Localize adds localized caption, hashtags, alt text and on-screen text to
+// the prompt's content package for every locale it does not have yet.
+// Locales in the package's own language are skipped.
+func (pg *PromptGenerator) Localize(ctx context.Context, prompt *VideoPrompt, locales []string) error {
+	pkg := prompt.Content
+	if pkg == nil {
+		return nil
+	}
+
+	for _, locale := range locales {
+		locale = normalizeLocale(locale)
+		if locale == "" || localeLanguage(locale) == localeLanguage(pkg.Language) {
+			continue
+		}
+		if _, ok := pkg.Localized[locale]; ok {
+			continue
+		}
+
+		localized, err := pg.localizeContent(ctx, pkg, locale, prompt.AccountID)
+		if err != nil {
+			return fmt.Errorf("failed to localize prompt %s for %s: %w", prompt.ID, locale, err)
+		}
+		if pkg.Localized == nil {
+			pkg.Localized = make(map[string]*LocalizedContent)
+		}
+		pkg.Localized[locale] = localized
+	}
+	return nil
+}
+
+func (pg *PromptGenerator) localizeContent(ctx context.Context, pkg *ContentPackage, locale, accountID string) (*LocalizedContent, error) {
+	original, err := json.Marshal(map[string]interface{}{
+		"caption":        pkg.Caption,
+		"hashtags":       pkg.Hashtags,
+		"alt_text":       pkg.AltText,
+		"on_screen_text": pkg.OnScreenText,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode content for localization: %w", err)
+	}
+
+	systemPrompt := fmt.Sprintf("You localize Instagram content for post-ironic cat videos into %s. Write like a native creator from that market: adapt jokes, slang and cultural references instead of translating word for word, and keep the tone weird but family-friendly. Hashtags must be ones that audience actually searches for, not literal translations. Keep on-screen text as short as the original.", locale)
+	userPrompt := fmt.Sprintf("The video shows: %s\n\nLocalize this content for %s:\n%s", pkg.VideoPrompt, locale, original)
+
+	var localized *LocalizedContent
+	_, err = pg.requestStructured(ctx, CompletionRequest{
+		System:      systemPrompt,
+		User:        userPrompt,
+		MaxTokens:   contentPackageTokens,
+		Temperature: 0.7,
+		AccountID:   accountID,
+	}, &JSONSchema{Name: "localized_content", Schema: localizedContentSchema}, func(text string) error {
+		var content LocalizedContent
+		if err := decodeStrictJSON(text, &content); err != nil {
+			return fmt.Errorf("reply is not a valid localized content JSON object: %w", err)
+		}
+		if err := content.Validate(); err != nil {
+			return err
+		}
+		localized = &content
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	localized.Language = locale
+	return localized, nil
+}
+
+func (lc *LocalizedContent) Validate() error {
+	var problems []string
+
+	lc.Caption = strings.TrimSpace(lc.Caption)
+	lc.AltText = strings.TrimSpace(lc.AltText)
+	lc.OnScreenText = strings.TrimSpace(lc.OnScreenText)
+
+	problems = append(problems, validateCaption(lc.Caption)...)
+	if lc.AltText == "" {
+		problems = append(problems, "alt_text is empty")
+	}
+	problems = append(problems, validateOnScreenText(lc.OnScreenText)...)
+	problems = append(problems, normalizeHashtags(lc.Hashtags)...)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid localized content: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (lc *LocalizedContent) CaptionWithHashtags() string {
+	return joinCaption(lc.Caption, lc.Hashtags)
+}
+
+// ForLocale returns the content for an account locale: an exact match,
+// then any localization in the same language, then the original.
+func (pkg *ContentPackage) ForLocale(locale string) LocalizedContent {
+	original := LocalizedContent{
+		Language:     pkg.Language,
+		Caption:      pkg.Caption,
+		Hashtags:     pkg.Hashtags,
+		AltText:      pkg.AltText,
+		OnScreenText: pkg.OnScreenText,
+	}
+
+	locale = normalizeLocale(locale)
+	if locale == "" || len(pkg.Localized) == 0 {
+		return original
+	}
+	if localized, ok := pkg.Localized[locale]; ok {
+		return *localized
+	}
+
+	language := localeLanguage(locale)
+	if language == localeLanguage(pkg.Language) {
+		return original
+	}
+	var match *LocalizedContent
+	for key, localized := range pkg.Localized {
+		// Pick deterministically when several regions share a language.
+		if localeLanguage(key) == language && (match == nil || key < match.Language) {
+			match = localized
+		}
+	}
+	if match != nil {
+		return *match
+	}
+	return original
+}
+
+// normalizeLocale canonicalizes the case and separator of a BCP 47 style
+// tag, so "pt_br" and "pt-BR" are the same locale.
+func normalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	if parts[0] == "" {
+		return ""
+	}
+
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func localeLanguage(locale string) string {
+	language, _, _ := strings.Cut(normalizeLocale(locale), "-")
+	return language
+}
+
+// AccountLocales returns the distinct locales of the given accounts.
+func AccountLocales(accounts []InstagramAccount) []string {
+	seen := make(map[string]bool)
+	var locales []string
+	for _, account := range accounts {
+		locale := normalizeLocale(account.Locale)
+		if locale != "" && !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+	return locales
+}
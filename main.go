@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -19,37 +20,169 @@ func main() {
 		log.Fatalf("❌ Environment setup error: %v", err)
 	}
 
-	provider := VideoProvider(getEnvWithDefault("VIDEO_PROVIDER", "veo2"))
-	fmt.Printf("📹 Using video provider: %s\n\n", provider)
+	videoPolicy, err := NewVideoFailoverPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Invalid video provider config: %v", err)
+	}
+	fmt.Printf("📹 Using video provider: %s\n\n", videoPolicy)
 
 	// Initialize components
 	fmt.Println("🔧 Initializing components...")
 
-	promptGen := NewPromptGenerator(os.Getenv("OPENAI_API_KEY"))
-	fmt.Println("✅ Prompt generator ready")
+	promptModel, err := NewPromptModelFromEnv(ctx)
+	if err != nil {
+		log.Fatalf("❌ Failed to create prompt model: %v", err)
+	}
+	promptGen := NewPromptGenerator(promptModel)
+	batchConfig, err := NewPromptBatchConfigFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Invalid prompt batch config: %v", err)
+	}
+	promptGen.SetBatchConfig(batchConfig)
+	promptGen.SetStrict(os.Getenv("PROMPT_STRICT") == "true")
+	if catalogPath := os.Getenv("PROMPT_CATALOG_PATH"); catalogPath != "" {
+		if err := promptGen.WatchCatalog(ctx, catalogPath, 10*time.Second); err != nil {
+			log.Fatalf("❌ Failed to load prompt catalog: %v", err)
+		}
+	}
 
-	videoGen, err := NewVideoGenerator(
-		os.Getenv("GEMINI_API_KEY"),
-		os.Getenv("REPLICATE_API_KEY"),
-		os.Getenv("VERTEX_API_KEY"),
-		os.Getenv("GOOGLE_PROJECT_ID"),
-		provider,
-	)
+	var novelty *NoveltyChecker
+	if historyPath := os.Getenv("PROMPT_HISTORY_PATH"); historyPath != "" {
+		noveltyConfig, err := NewNoveltyConfigFromEnv()
+		if err != nil {
+			log.Fatalf("❌ Invalid novelty config: %v", err)
+		}
+		history, err := LoadPromptHistory(historyPath)
+		if err != nil {
+			log.Fatalf("❌ Failed to load prompt history: %v", err)
+		}
+		novelty = NewNoveltyChecker(history, noveltyConfig, promptModel)
+		promptGen.SetNoveltyChecker(novelty)
+	}
+	trends, err := NewTrendPoolFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Invalid trend config: %v", err)
+	}
+	if trends != nil {
+		trends.Watch(ctx)
+		promptGen.SetTrends(trends)
+	}
+	runConfig, err := NewRunConfigFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Invalid run config: %v", err)
+	}
+	promptGen.SetSeed(runConfig.Seed)
+	fmt.Printf("✅ Prompt generator ready (%s, seed %d)\n", promptModel.Name(), runConfig.Seed)
+	if runConfig.LogDir != "" {
+		run, err := promptGen.StartRun(runConfig.LogDir)
+		if err != nil {
+			log.Fatalf("❌ Failed to start run log: %v", err)
+		}
+		fmt.Printf("   📼 Logging run %s\n", run.ID)
+	}
+
+	videoGen, err := NewVideoGenerator(ctx, videoPolicy)
 	if err != nil {
 		log.Fatalf("❌ Failed to create video generator: %v", err)
 	}
-	fmt.Println("✅ Video generator ready")
+	capabilities := videoGen.Capabilities()
+	fmt.Printf("✅ Video generator ready (up to %ds, %s, audio: %t, $%.2f/s)\n",
+		capabilities.MaxDurationSeconds, strings.Join(capabilities.AspectRatios, "/"), capabilities.Audio, capabilities.PricePerSecond)
+
+	webhooks, err := NewReplicateWebhookServerFromEnv(ctx)
+	if err != nil {
+		log.Fatalf("❌ Invalid Replicate webhook config: %v", err)
+	}
+	if webhooks != nil {
+		if err := webhooks.Start(); err != nil {
+			log.Fatalf("❌ Failed to start Replicate webhook server: %v", err)
+		}
+		defer webhooks.Shutdown(context.Background())
+		videoGen.SetReplicateWebhooks(webhooks)
+		fmt.Printf("   🪝 Receiving Replicate webhooks at %s\n", os.Getenv("REPLICATE_WEBHOOK_URL"))
+	}
+
+	assets, err := NewAssetStoreFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Invalid asset store config: %v", err)
+	}
+	if assets != nil {
+		videoGen.SetAssetStore(assets)
+		fmt.Printf("   📦 Storing videos in %s\n", assets)
+	}
+
+	budget, err := NewBudgetFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Invalid budget config: %v", err)
+	}
+	if budget != nil {
+		promptGen.SetBudget(budget)
+		videoGen.SetBudget(budget)
+		fmt.Printf("   💰 Recording spend in %s\n", budget.Ledger().Path())
+	}
+
+	if jobDir := os.Getenv("VIDEO_JOB_DIR"); jobDir != "" {
+		jobs, err := OpenVideoJobQueue(jobDir)
+		if err != nil {
+			log.Fatalf("❌ Failed to open video job queue: %v", err)
+		}
+		videoGen.SetJobQueue(jobs)
+
+		resumed, err := videoGen.ResumeJobs(ctx)
+		if err != nil {
+			log.Fatalf("❌ Failed to resume video jobs: %v", err)
+		}
+		for _, result := range resumed {
+			if result.Err != nil {
+				fmt.Printf("   ❌ Resumed job for %s failed: %v\n", result.Prompt.ID, result.Err)
+				continue
+			}
+			fmt.Printf("   ♻️  Resumed %s video %s\n", result.Video.Provider, result.Video.ID)
+		}
+		fmt.Printf("   🗂️  Video jobs in %s: %s\n", jobDir, formatJobCounts(jobs.Counts()))
+	}
 
 	// Test 1: Generate some prompts
 	fmt.Println("\n🎭 Generating test prompts...")
-	prompts, err := promptGen.GenerateBatch(ctx, 3)
+	results, err := promptGen.GenerateBatch(ctx, 3)
 	if err != nil {
 		log.Fatalf("❌ Failed to generate prompts: %v", err)
 	}
+	prompts := SuccessfulPrompts(results)
+
+	fmt.Printf("✅ Generated %d/%d prompts:\n", len(prompts), len(results))
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("   %d. ❌ %v\n", result.Index+1, result.Err)
+			continue
+		}
+		fmt.Printf("   %d. [%s/%s] %s\n", result.Index+1, result.Prompt.Source, result.Prompt.Theme, result.Prompt.Text)
+	}
+	if novelty != nil {
+		fmt.Printf("   🔁 %s\n", novelty.Report())
+	}
 
-	fmt.Printf("✅ Generated %d prompts:\n", len(prompts))
-	for i, prompt := range prompts {
-		fmt.Printf("   %d. [%s] %s\n", i+1, prompt.Theme, prompt.Text)
+	moderation, err := NewModerationGateFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Failed to set up moderation: %v", err)
+	}
+	if moderation != nil {
+		prompts = moderation.Filter(ctx, prompts, nil)
+		fmt.Printf("   🛡️  %d prompts passed moderation\n", len(prompts))
+	}
+
+	if os.Getenv("JUDGE_TOP_K") != "" {
+		judgeConfig, err := NewJudgeConfigFromEnv()
+		if err != nil {
+			log.Fatalf("❌ Invalid judge config: %v", err)
+		}
+		prompts, err = NewPromptJudge(promptGen, judgeConfig).SelectTop(ctx, prompts)
+		if err != nil {
+			log.Fatalf("❌ Failed to score prompts: %v", err)
+		}
+		for _, prompt := range prompts {
+			fmt.Printf("   ⚖️  %.1f/10 %s\n", prompt.Score.Overall, prompt.Score.Rationale)
+		}
 	}
 
 	// Test 2: Generate a video from the first prompt
@@ -67,7 +200,30 @@ func main() {
 			fmt.Printf("✅ Video generated successfully!\n")
 			fmt.Printf("   📁 Video ID: %s\n", video.ID)
 			fmt.Printf("   🔗 Video URL: %s\n", video.VideoURL)
+			if len(video.FailedOver) > 0 {
+				fmt.Printf("   🔀 Generated by %s after %d provider(s) failed\n", video.Provider, len(video.FailedOver))
+			}
+			if video.LocalPath != "" {
+				fmt.Printf("   💾 Saved to: %s\n", video.LocalPath)
+			}
+			if video.AssetSHA256 != "" {
+				fmt.Printf("   📦 Asset: %s\n", video.AssetSHA256)
+			}
 			fmt.Printf("   ⏱️  Duration: %d seconds\n", video.Duration)
+			if metadata := video.Metadata; metadata != nil {
+				fmt.Printf("   🎞️  %dx%d (%s) %s at %.2f fps, audio: %s\n",
+					metadata.Width, metadata.Height, metadata.AspectRatio, metadata.VideoCodec, metadata.FrameRate, formatAudio(metadata))
+				check := CheckReels(metadata)
+				for _, problem := range check.Problems {
+					fmt.Printf("   🚫 Not postable as a Reel: %s\n", problem)
+				}
+				for _, warning := range check.Warnings {
+					fmt.Printf("   ⚠️  %s\n", warning)
+				}
+			}
+			if video.Cost > 0 {
+				fmt.Printf("   💸 Cost: $%.2f\n", video.Cost)
+			}
 			fmt.Printf("   🕐 Generation time: %v\n", duration)
 		}
 	}
@@ -88,6 +244,9 @@ func main() {
 		fmt.Printf("✅ Custom video generated successfully!\n")
 		fmt.Printf("   📁 Video ID: %s\n", customVideo.ID)
 		fmt.Printf("   🔗 Video URL: %s\n", customVideo.VideoURL)
+		if customVideo.LocalPath != "" {
+			fmt.Printf("   💾 Saved to: %s\n", customVideo.LocalPath)
+		}
 		fmt.Printf("   ⏱️  Duration: %d seconds\n", customVideo.Duration)
 		fmt.Printf("   🕐 Generation time: %v\n", duration)
 	}
@@ -95,25 +254,34 @@ func main() {
 	fmt.Println("\n🎉 Video generation tests complete!")
 	fmt.Println("\nNext steps:")
 	fmt.Println("• Check the video URLs above to see your generated content")
-	fmt.Println("• Try different VIDEO_PROVIDER values in .env (veo2, veo3-replicate, veo3-vertex)")
+	fmt.Printf("• Try different VIDEO_PROVIDER values in .env (%s)\n", videoProviderNames())
 	fmt.Println("• Run 'go run main_full.go' to test the complete Instagram posting pipeline")
 }
 
 func checkRequiredEnvVars() error {
-	required := map[string]string{
-		"OPENAI_API_KEY": "OpenAI API key for prompt generation",
-	}
+	required := map[string]string{}
 
-	provider := getEnvWithDefault("VIDEO_PROVIDER", "veo2")
+	switch PromptModelProvider(getEnvWithDefault("PROMPT_MODEL_PROVIDER", string(PromptModelOpenAI))) {
+	case PromptModelOpenAI:
+		required["OPENAI_API_KEY"] = "OpenAI API key for prompt generation"
+	case PromptModelGemini:
+		required["GEMINI_API_KEY"] = "Gemini API key for prompt generation"
+	}
 
-	switch VideoProvider(provider) {
-	case Veo2:
-		required["GEMINI_API_KEY"] = "Gemini API key for Veo 2 video generation"
-	case Veo3Replicate:
-		required["REPLICATE_API_KEY"] = "Replicate API key for Veo 3 video generation"
-	case Veo3Vertex:
-		required["VERTEX_API_KEY"] = "Vertex AI access token for Veo 3 video generation"
-		required["GOOGLE_PROJECT_ID"] = "Google Cloud project ID for Vertex AI"
+	policy, err := NewVideoFailoverPolicyFromEnv()
+	if err != nil {
+		return err
+	}
+	backends := make([]VideoBackendSpec, 0, len(policy.Chain))
+	for _, provider := range policy.Chain {
+		backend, ok := LookupVideoBackend(provider)
+		if !ok {
+			return fmt.Errorf("unknown VIDEO_PROVIDER %q (available: %s)", provider, videoProviderNames())
+		}
+		for env, description := range backend.Env {
+			required[env] = description
+		}
+		backends = append(backends, backend)
 	}
 
 	var missing []string
@@ -128,6 +296,14 @@ func checkRequiredEnvVars() error {
 			fmt.Sprintf("%s", missing))
 	}
 
+	for _, backend := range backends {
+		if backend.Validate != nil {
+			if err := backend.Validate(); err != nil {
+				return fmt.Errorf("invalid %s config: %w", backend.Provider, err)
+			}
+		}
+	}
+
 	return nil
 }
 
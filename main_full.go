@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 func main() {
@@ -13,78 +15,412 @@ func main() {
 	ctx := context.Background()
 
 	// Initialize components
-	promptGen := NewPromptGenerator(os.Getenv("OPENAI_API_KEY"))
-	
-	videoGen, err := NewVideoGenerator(
-		os.Getenv("GEMINI_API_KEY"),
-		os.Getenv("REPLICATE_API_KEY"),
-		os.Getenv("VERTEX_API_KEY"),
-		os.Getenv("GOOGLE_PROJECT_ID"),
-		VideoProvider(getEnvWithDefault("VIDEO_PROVIDER", "veo2")),
-	)
+	promptModel, err := NewPromptModelFromEnv(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create prompt model: %v", err)
+	}
+	promptGen := NewPromptGenerator(promptModel)
+	batchConfig, err := NewPromptBatchConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid prompt batch config: %v", err)
+	}
+	promptGen.SetBatchConfig(batchConfig)
+	promptGen.SetStrict(os.Getenv("PROMPT_STRICT") == "true")
+	if catalogPath := os.Getenv("PROMPT_CATALOG_PATH"); catalogPath != "" {
+		if err := promptGen.WatchCatalog(ctx, catalogPath, 10*time.Second); err != nil {
+			log.Fatalf("Failed to load prompt catalog: %v", err)
+		}
+	}
+
+	var novelty *NoveltyChecker
+	var history *PromptHistory
+	if historyPath := os.Getenv("PROMPT_HISTORY_PATH"); historyPath != "" {
+		noveltyConfig, err := NewNoveltyConfigFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid novelty config: %v", err)
+		}
+		history, err = LoadPromptHistory(historyPath)
+		if err != nil {
+			log.Fatalf("Failed to load prompt history: %v", err)
+		}
+		novelty = NewNoveltyChecker(history, noveltyConfig, promptModel)
+		promptGen.SetNoveltyChecker(novelty)
+	}
+	trends, err := NewTrendPoolFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid trend config: %v", err)
+	}
+	if trends != nil {
+		trends.Watch(ctx)
+		promptGen.SetTrends(trends)
+	}
+	if biblePath := os.Getenv("CHARACTER_BIBLE_PATH"); biblePath != "" {
+		characters, err := LoadCharacterRegistry(biblePath)
+		if err != nil {
+			log.Fatalf("Failed to load character bible: %v", err)
+		}
+		promptGen.SetCharacters(characters)
+	}
+
+	videoPolicy, err := NewVideoFailoverPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid video provider config: %v", err)
+	}
+	videoGen, err := NewVideoGenerator(ctx, videoPolicy)
 	if err != nil {
 		log.Fatalf("Failed to create video generator: %v", err)
 	}
+	videoBatchConfig, err := NewVideoBatchConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid video batch config: %v", err)
+	}
+	videoGen.SetBatchConfig(videoBatchConfig)
+	videoGen.OnProgress(func(progress VideoProgress) {
+		switch progress.Stage {
+		case VideoGenerating, VideoFailedOver, VideoSucceeded, VideoFailed:
+			fmt.Printf("Video %d: %s %s\n", progress.Index+1, progress.Stage, progress.Provider)
+		}
+	})
+
+	webhooks, err := NewReplicateWebhookServerFromEnv(ctx)
+	if err != nil {
+		log.Fatalf("Invalid Replicate webhook config: %v", err)
+	}
+	if webhooks != nil {
+		if err := webhooks.Start(); err != nil {
+			log.Fatalf("Failed to start Replicate webhook server: %v", err)
+		}
+		defer webhooks.Shutdown(context.Background())
+		videoGen.SetReplicateWebhooks(webhooks)
+	}
+
+	assets, err := NewAssetStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid asset store config: %v", err)
+	}
+	if assets != nil {
+		videoGen.SetAssetStore(assets)
+	}
+	// Fail before paying for videos that could never be posted.
+	if private := videoPolicy.PrivateURLProviders(); len(private) > 0 && (assets == nil || assets.PublicURL() == "") {
+		log.Fatalf("%s video URLs need provider credentials, set ASSET_STORE and ASSET_PUBLIC_URL so Instagram can fetch them", private[0])
+	}
+
+	budget, err := NewBudgetFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid budget config: %v", err)
+	}
+	if budget != nil {
+		promptGen.SetBudget(budget)
+		videoGen.SetBudget(budget)
+	}
+
+	// Videos a previous run submitted but never saw finish are posted with
+	// this run's.
+	var resumed []VideoResult
+	if jobDir := os.Getenv("VIDEO_JOB_DIR"); jobDir != "" {
+		jobs, err := OpenVideoJobQueue(jobDir)
+		if err != nil {
+			log.Fatalf("Failed to open video job queue: %v", err)
+		}
+		videoGen.SetJobQueue(jobs)
+
+		resumed, err = videoGen.ResumeJobs(ctx)
+		if err != nil {
+			log.Fatalf("Failed to resume video jobs: %v", err)
+		}
+		if len(resumed) > 0 {
+			fmt.Printf("Resumed %d/%d unfinished video jobs\n", len(SuccessfulVideos(resumed)), len(resumed))
+		}
+		fmt.Printf("Video jobs: %s\n", formatJobCounts(jobs.Counts()))
+	}
 
 	tracker := NewPerformanceTracker()
 
-	testAccounts := []InstagramAccount{
-		{
-			ID:            "test1",
-			Username:      "cat_vibes_1",
-			AccessToken:   os.Getenv("INSTA_TOKEN_1"),
-			IsMainAccount: false,
-			IsActive:      true,
-		},
-		{
-			ID:            "test2",
-			Username:      "cat_vibes_2",
-			AccessToken:   os.Getenv("INSTA_TOKEN_2"),
-			IsMainAccount: false,
-			IsActive:      true,
-		},
-		{
-			ID:            "main",
-			Username:      "main_cat_account",
-			AccessToken:   os.Getenv("INSTA_TOKEN_MAIN"),
-			IsMainAccount: true,
-			IsActive:      true,
-		},
+	if os.Getenv("BANDIT_STATE_PATH") != "" {
+		banditConfig, err := NewBanditConfigFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid bandit config: %v", err)
+		}
+		bandit, err := LoadPromptBandit(banditConfig)
+		if err != nil {
+			log.Fatalf("Failed to load prompt bandit: %v", err)
+		}
+		promptGen.SetBandit(bandit)
+		tracker.OnPerformance(bandit.ObservePerformance)
 	}
 
+	testAccounts := InstagramAccountsFromEnv()
+
 	poster := NewInstagramPoster(testAccounts)
+	if assets != nil {
+		poster.SetAssetStore(assets)
+	}
+	postProcessor, err := NewPostProcessorFromEnv(assets)
+	if err != nil {
+		log.Fatalf("Invalid post-processing config: %v", err)
+	}
+	if postProcessor != nil {
+		poster.SetPostProcessor(postProcessor)
+	}
+
+	// Posts from earlier runs are measured once they have had time to
+	// collect engagement, which feeds the bandit and later evolution.
+	// Performance measured before is restored so evolution sees every post.
+	postLog, err := NewPostLogFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid post log config: %v", err)
+	}
+	if postLog != nil {
+		poster.SetPostLog(postLog)
+		tracker.Restore(postLog.Performances())
+		performances := poster.MeasurePosts(ctx, postLog.Due(time.Now()))
+		for _, performance := range performances {
+			tracker.AddPerformance(performance)
+		}
+		if len(performances) > 0 {
+			fmt.Printf("Measured %d earlier posts\n", len(performances))
+		}
+	}
+	// Generation 0 is plain catalog sampling, so this shows whether
+	// evolved prompts do better.
+	if history != nil {
+		for _, stats := range tracker.EngagementByGeneration(history) {
+			fmt.Printf("Generation %d: %.2f%% engagement over %d posts\n", stats.Generation, stats.EngagementRate*100, stats.Posts)
+		}
+	}
+
+	runConfig, err := NewRunConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid run config: %v", err)
+	}
+	promptGen.SetSeed(runConfig.Seed)
+	poster.SetSeed(runConfig.Seed)
+	fmt.Printf("Run seed: %d\n", runConfig.Seed)
+	if runConfig.LogDir != "" {
+		run, err := promptGen.StartRun(runConfig.LogDir)
+		if err != nil {
+			log.Fatalf("Failed to start run log: %v", err)
+		}
+		fmt.Printf("Logging run %s\n", run.ID)
+	}
+
+	// Every prompt is generated for the test account it will be posted to,
+	// so that account's cast, budget and moderation rules apply.
+	var targetAccounts []InstagramAccount
+	for _, account := range testAccounts {
+		if !account.IsMainAccount && account.IsActive {
+			targetAccounts = append(targetAccounts, account)
+		}
+	}
+	if len(targetAccounts) == 0 {
+		log.Fatalf("No active test accounts to post to")
+	}
 
 	// Generate content
-	prompts, err := promptGen.GenerateBatch(ctx, 3)
+	var prompts []*VideoPrompt
+	for _, account := range targetAccounts {
+		results, err := promptGen.GenerateBatchFor(ctx, 3, PromptRequest{AccountID: account.ID})
+		if err != nil {
+			log.Fatalf("Failed to generate prompts for @%s: %v", account.Username, err)
+		}
+		accountPrompts := SuccessfulPrompts(results)
+
+		fmt.Printf("Generated %d/%d prompts for @%s:\n", len(accountPrompts), len(results), account.Username)
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Printf("%d. failed: %v\n", result.Index+1, result.Err)
+				continue
+			}
+			fmt.Printf("%d. [%s] %s\n", result.Index+1, result.Prompt.Source, result.Prompt.Text)
+		}
+		prompts = append(prompts, accountPrompts...)
+	}
+	if novelty != nil {
+		fmt.Println(novelty.Report())
+	}
+
+	if os.Getenv("EVOLVE_OFFSPRING") != "" {
+		if novelty == nil {
+			log.Fatalf("EVOLVE_OFFSPRING requires PROMPT_HISTORY_PATH to look up the prompts behind top posts")
+		}
+		evolutionConfig, err := NewEvolutionConfigFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid evolution config: %v", err)
+		}
+		evolver := NewPromptEvolver(promptGen, tracker, novelty, evolutionConfig)
+		for _, account := range targetAccounts {
+			offspring, err := evolver.Evolve(ctx, evolutionConfig.Offspring, PromptRequest{AccountID: account.ID})
+			if err != nil {
+				fmt.Printf("Warning: Skipping evolution for @%s: %v\n", account.Username, err)
+			}
+			for _, child := range offspring {
+				fmt.Printf("Evolved for @%s (generation %d): %s\n", account.Username, child.Generation, child.Text)
+			}
+			prompts = append(prompts, offspring...)
+		}
+	}
+
+	// The arc is only saved past an episode once that episode is posted.
+	arcPath := os.Getenv("SERIES_ARC_PATH")
+	var arc *SeriesArc
+	var episode *VideoPrompt
+	if arcPath != "" {
+		resumedPrompts := make([]*VideoPrompt, 0, len(resumed))
+		for _, result := range resumed {
+			if result.Err == nil {
+				resumedPrompts = append(resumedPrompts, result.Prompt)
+			}
+		}
+		seriesAccount := getEnvWithDefault("SERIES_ACCOUNT", targetAccounts[0].ID)
+		arc, episode, err = generateSeriesEpisode(ctx, NewSeriesGenerator(promptGen), arcPath, seriesAccount, resumedPrompts)
+		if err != nil {
+			log.Fatalf("Failed to generate series episode: %v", err)
+		}
+		for _, retention := range tracker.SeriesRetention(arc) {
+			fmt.Printf("Series episode %d: %d views over %d posts (%.0f%% of episode 1)\n",
+				retention.EpisodeNumber, retention.Views, retention.Posts, retention.Retention*100)
+		}
+		if episode != nil {
+			fmt.Printf("Series episode %d: %s\n", episode.EpisodeNumber, episode.Text)
+		}
+	}
+
+	// Only approved prompts are judged, so rejections cannot push the batch
+	// below the judge's top K.
+	moderation, err := NewModerationGateFromEnv()
 	if err != nil {
-		log.Fatalf("Failed to generate prompts: %v", err)
+		log.Fatalf("Failed to set up moderation: %v", err)
+	}
+	if moderation != nil {
+		prompts = moderation.Filter(ctx, prompts, nil)
+		fmt.Printf("%d prompts passed moderation\n", len(prompts))
+		if episode != nil && len(moderation.Filter(ctx, []*VideoPrompt{episode}, nil)) == 0 {
+			fmt.Printf("Series episode %d was rejected by moderation\n", episode.EpisodeNumber)
+			episode = nil
+		}
 	}
 
-	fmt.Printf("Generated %d prompts:\n", len(prompts))
-	for i, prompt := range prompts {
-		fmt.Printf("%d. %s\n", i+1, prompt.Text)
+	// The judge picks the top K per account, so no account is left without
+	// videos. The series episode is not judged: dropping it would stall the
+	// arc and pay for the same episode again next run.
+	if os.Getenv("JUDGE_TOP_K") != "" {
+		judgeConfig, err := NewJudgeConfigFromEnv()
+		if err != nil {
+			log.Fatalf("Invalid judge config: %v", err)
+		}
+		prompts, err = NewPromptJudge(promptGen, judgeConfig).SelectTopPerAccount(ctx, prompts)
+		if err != nil {
+			log.Fatalf("Failed to score prompts: %v", err)
+		}
+		for _, prompt := range prompts {
+			fmt.Printf("Judge picked %s for %s (%.1f): %s\n", prompt.ID, prompt.AccountID, prompt.Score.Overall, prompt.Score.Rationale)
+		}
+	}
+	if episode != nil {
+		prompts = append(prompts, episode)
 	}
 
-	videos, err := videoGen.GenerateBatch(ctx, prompts)
+	accountsByID := make(map[string]*InstagramAccount, len(targetAccounts))
+	for i := range targetAccounts {
+		accountsByID[targetAccounts[i].ID] = &targetAccounts[i]
+	}
+
+	localized := false
+	for _, prompt := range prompts {
+		account, ok := accountsByID[prompt.AccountID]
+		if !ok || account.Locale == "" {
+			continue
+		}
+		if err := promptGen.Localize(ctx, prompt, []string{account.Locale}); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+		localized = true
+	}
+	if localized {
+		fmt.Printf("Localized content for %v\n", AccountLocales(targetAccounts))
+	}
+
+	// Translations are new viewer-facing text, so they are checked too.
+	if moderation != nil && localized {
+		prompts = moderation.Filter(ctx, prompts, nil)
+		fmt.Printf("%d prompts passed moderation after localization\n", len(prompts))
+	}
+
+	videoResults, err := videoGen.GenerateBatch(ctx, prompts)
 	if err != nil {
 		log.Fatalf("Failed to generate videos: %v", err)
 	}
+	fmt.Printf("Generated %d/%d videos\n", len(SuccessfulVideos(videoResults)), len(videoResults))
 
-	fmt.Printf("Generated %d videos\n", len(videos))
-
-	// Post to test accounts
-	for _, video := range videos {
-		postIDs, err := poster.PostToTestAccounts(ctx, video)
+	// Post each video to the test account its prompt was made for, with
+	// videos a previous run submitted but never saw finish first
+	for _, result := range append(resumed, videoResults...) {
+		if result.Err != nil || result.Video == nil {
+			continue
+		}
+		video := result.Video
+		account, ok := accountsByID[video.AccountID]
+		if !ok {
+			fmt.Printf("Warning: Skipping video %s made for %q, which is not an active test account\n", video.ID, video.AccountID)
+			continue
+		}
+		postID, err := poster.PostToAccount(ctx, video, account)
 		if err != nil {
-			fmt.Printf("Warning: Failed to post video %s: %v\n", video.ID, err)
+			fmt.Printf("Warning: Failed to post video %s to @%s: %v\n", video.ID, account.Username, err)
 			continue
 		}
-		fmt.Printf("Posted video %s to %d test accounts\n", video.ID, len(postIDs))
+		fmt.Printf("Posted video %s to @%s as %s\n", video.ID, account.Username, postID)
+
+		if arc != nil && arc.MarkPosted(result.Prompt) {
+			if err := arc.Save(arcPath); err != nil {
+				fmt.Printf("Warning: Failed to save series arc: %v\n", err)
+			}
+		}
 	}
 
 	fmt.Println("✅ Content generation and posting complete!")
 }
 
+// generateSeriesEpisode continues the arc stored at path, planning a new
+// one for accountID from SERIES_IDEA and SERIES_EPISODES when the file
+// does not exist yet or the previous arc has finished. No episode is
+// generated while one from an earlier run is still pending.
+func generateSeriesEpisode(ctx context.Context, series *SeriesGenerator, path, accountID string, pending []*VideoPrompt) (*SeriesArc, *VideoPrompt, error) {
+	arc, err := LoadSeriesArc(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	if arc == nil || arc.Finished() {
+		episodes, err := strconv.Atoi(getEnvWithDefault("SERIES_EPISODES", "7"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid SERIES_EPISODES: %w", err)
+		}
+		arc, err = series.PlanArc(ctx, os.Getenv("SERIES_IDEA"), episodes, PromptRequest{AccountID: accountID})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := arc.Save(path); err != nil {
+			return nil, nil, err
+		}
+		fmt.Printf("Planned series \"%s\": %s\n", arc.Title, arc.Premise)
+	}
+
+	for _, prompt := range pending {
+		if prompt.SeriesID == arc.ID && prompt.EpisodeNumber >= arc.NextEpisode {
+			fmt.Printf("Series episode %d is still pending from an earlier run\n", prompt.EpisodeNumber)
+			return arc, nil, nil
+		}
+	}
+
+	episode, err := series.GenerateNextEpisode(ctx, arc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return arc, episode, nil
+}
+
 func getEnvWithDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
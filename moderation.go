@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrPromptRejected = errors.New("prompt rejected by moderation")
+
+type ModerationVerdict struct {
+	Approved  bool      `json:"approved"`
+	Reasons   []string  `json:"reasons,omitempty"`
+	Checkers  []string  `json:"checkers"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type RuleSet struct {
+	Blocklist    []string `yaml:"blocklist"`
+	Patterns     []string `yaml:"patterns"`
+	BannedTopics []string `yaml:"banned_topics"`
+}
+
+type ModerationRules struct {
+	RuleSet  `yaml:",inline"`
+	Accounts map[string]RuleSet `yaml:"accounts"`
+}
+
+type compiledRule struct {
+	pattern *regexp.Regexp
+	reason  string
+}
+
+// ModerationAPI is an optional remote classifier consulted after the local
+// rules pass. It returns the reasons a text was flagged, if any.
+type ModerationAPI interface {
+	Name() string
+	Moderate(ctx context.Context, text string) ([]string, error)
+}
+
+// ModerationGate sits between PromptGenerator and VideoGenerator. Local
+// rules are checked first; the API, when configured, only sees prompts
+// that already passed them.
+type ModerationGate struct {
+	global   []compiledRule
+	accounts map[string][]compiledRule
+	api      ModerationAPI
+}
+
+func LoadModerationRules(path string) (*ModerationRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation rules: %w", err)
+	}
+
+	var rules ModerationRules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse moderation rules %s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+func NewModerationGate(rules *ModerationRules, api ModerationAPI) (*ModerationGate, error) {
+	gate := &ModerationGate{
+		accounts: make(map[string][]compiledRule),
+		api:      api,
+	}
+	if rules == nil {
+		return gate, nil
+	}
+
+	var err error
+	if gate.global, err = compileRuleSet(rules.RuleSet); err != nil {
+		return nil, fmt.Errorf("global moderation rules: %w", err)
+	}
+	for accountID, ruleSet := range rules.Accounts {
+		if gate.accounts[accountID], err = compileRuleSet(ruleSet); err != nil {
+			return nil, fmt.Errorf("moderation rules for account %s: %w", accountID, err)
+		}
+	}
+
+	return gate, nil
+}
+
+// NewModerationGateFromEnv builds the gate from MODERATION_RULES_PATH and
+// MODERATION_API. It returns nil when neither is set.
+func NewModerationGateFromEnv() (*ModerationGate, error) {
+	rulesPath := os.Getenv("MODERATION_RULES_PATH")
+	apiName := os.Getenv("MODERATION_API")
+	if rulesPath == "" && apiName == "" {
+		return nil, nil
+	}
+
+	var rules *ModerationRules
+	if rulesPath != "" {
+		var err error
+		if rules, err = LoadModerationRules(rulesPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var api ModerationAPI
+	switch apiName {
+	case "":
+	case "openai":
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for the openai moderation API")
+		}
+		api = NewOpenAIModerator(apiKey)
+	default:
+		return nil, fmt.Errorf("unknown moderation API: %s", apiName)
+	}
+
+	return NewModerationGate(rules, api)
+}
+
+func compileRuleSet(ruleSet RuleSet) ([]compiledRule, error) {
+	rules := make([]compiledRule, 0, len(ruleSet.Blocklist)+len(ruleSet.Patterns)+len(ruleSet.BannedTopics))
+
+	for _, term := range ruleSet.Blocklist {
+		if strings.TrimSpace(term) == "" {
+			return nil, fmt.Errorf("blocklist has an empty term")
+		}
+		rules = append(rules, compiledRule{
+			pattern: termPattern(term),
+			reason:  fmt.Sprintf("blocked term %q", term),
+		})
+	}
+	for _, topic := range ruleSet.BannedTopics {
+		if strings.TrimSpace(topic) == "" {
+			return nil, fmt.Errorf("banned_topics has an empty topic")
+		}
+		rules = append(rules, compiledRule{
+			pattern: termPattern(topic),
+			reason:  fmt.Sprintf("banned topic %q", topic),
+		})
+	}
+	for _, expr := range ruleSet.Patterns {
+		pattern, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", expr, err)
+		}
+		rules = append(rules, compiledRule{
+			pattern: pattern,
+			reason:  fmt.Sprintf("matched pattern %q", expr),
+		})
+	}
+
+	return rules, nil
+}
+
+// termPattern matches term case-insensitively as a whole word. Word
+// boundaries are only required on sides where the term ends in a word
+// character, since \b next to "#" or "+" would demand a letter outside.
+func termPattern(term string) *regexp.Regexp {
+	term = strings.TrimSpace(term)
+	expr := regexp.QuoteMeta(term)
+	if isWordByte(term[0]) {
+		expr = `\b` + expr
+	}
+	if isWordByte(term[len(term)-1]) {
+		expr += `\b`
+	}
+	return regexp.MustCompile(`(?i)` + expr)
+}
+
+// isWordByte reports whether b is an ASCII word character, the only kind
+// \b recognizes.
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// Review checks the prompt against the global rules, the rules of the
+// account it was made for and of every other account it may be posted to,
+// records the verdict on the prompt and returns it.
+func (mg *ModerationGate) Review(ctx context.Context, prompt *VideoPrompt, accountIDs []string) *ModerationVerdict {
+	verdict := &ModerationVerdict{
+		Checkers:  []string{"rules"},
+		CheckedAt: time.Now(),
+	}
+
+	texts := moderationTexts(prompt)
+
+	rules := append([]compiledRule{}, mg.global...)
+	if prompt.AccountID != "" {
+		rules = append(rules, mg.accounts[prompt.AccountID]...)
+	}
+	for _, accountID := range accountIDs {
+		if accountID == prompt.AccountID {
+			continue
+		}
+		rules = append(rules, mg.accounts[accountID]...)
+	}
+
+	for _, rule := range rules {
+		for _, text := range texts {
+			if rule.pattern.MatchString(text.text) {
+				verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%s in %s", rule.reason, text.field))
+			}
+		}
+	}
+
+	if len(verdict.Reasons) == 0 && mg.api != nil {
+		verdict.Checkers = append(verdict.Checkers, mg.api.Name())
+
+		combined := make([]string, 0, len(texts))
+		for _, text := range texts {
+			combined = append(combined, text.text)
+		}
+
+		reasons, err := mg.api.Moderate(ctx, strings.Join(combined, "\n"))
+		if err != nil {
+			// Fail closed: an unchecked prompt must not reach a paid provider.
+			verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("moderation API unavailable: %v", err))
+		}
+		verdict.Reasons = append(verdict.Reasons, reasons...)
+	}
+
+	verdict.Approved = len(verdict.Reasons) == 0
+	prompt.Moderation = verdict
+	return verdict
+}
+
+// Filter reviews every prompt and returns the approved ones.
+func (mg *ModerationGate) Filter(ctx context.Context, prompts []*VideoPrompt, accountIDs []string) []*VideoPrompt {
+	approved := make([]*VideoPrompt, 0, len(prompts))
+	for _, prompt := range prompts {
+		verdict := mg.Review(ctx, prompt, accountIDs)
+		if !verdict.Approved {
+			fmt.Printf("Moderation rejected prompt %s: %s\n", prompt.ID, strings.Join(verdict.Reasons, "; "))
+			continue
+		}
+		approved = append(approved, prompt)
+	}
+	return approved
+}
+
+type moderationText struct {
+	field string
+	text  string
+}
+
+// moderationTexts lists every viewer-facing text of the prompt, including
+// each localization, in a stable order.
+func moderationTexts(prompt *VideoPrompt) []moderationText {
+	texts := []moderationText{
+		{"prompt", prompt.Text},
+		{"theme", prompt.Theme},
+		{"situation", prompt.Situation},
+	}
+
+	pkg := prompt.Content
+	if pkg == nil {
+		return texts
+	}
+	texts = append(texts,
+		moderationText{"caption", pkg.Caption},
+		moderationText{"hashtags", strings.Join(pkg.Hashtags, " ")},
+		moderationText{"alt text", pkg.AltText},
+		moderationText{"on-screen text", pkg.OnScreenText},
+	)
+
+	locales := make([]string, 0, len(pkg.Localized))
+	for locale := range pkg.Localized {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	for _, locale := range locales {
+		localized := pkg.Localized[locale]
+		texts = append(texts,
+			moderationText{"caption (" + locale + ")", localized.Caption},
+			moderationText{"hashtags (" + locale + ")", strings.Join(localized.Hashtags, " ")},
+			moderationText{"alt text (" + locale + ")", localized.AltText},
+			moderationText{"on-screen text (" + locale + ")", localized.OnScreenText},
+		)
+	}
+	return texts
+}
+
+type openAIModerator struct {
+	client *openai.Client
+}
+
+func NewOpenAIModerator(apiKey string) ModerationAPI {
+	return &openAIModerator{client: openai.NewClient(apiKey)}
+}
+
+func (m *openAIModerator) Name() string {
+	return "openai-moderation"
+}
+
+func (m *openAIModerator) Moderate(ctx context.Context, text string) ([]string, error) {
+	resp, err := m.client.Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: openai.ModerationOmniLatest,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("openai moderation failed: %w", err)
+	}
+
+	var reasons []string
+	for _, result := range resp.Results {
+		if !result.Flagged {
+			continue
+		}
+		flaggedCategories := 0
+		for category, flagged := range moderationCategories(result.Categories) {
+			if flagged {
+				reasons = append(reasons, "flagged by moderation API: "+category)
+				flaggedCategories++
+			}
+		}
+		if flaggedCategories == 0 {
+			reasons = append(reasons, "flagged by moderation API")
+		}
+	}
+	sort.Strings(reasons)
+	return reasons, nil
+}
+
+func moderationCategories(c openai.ResultCategories) map[string]bool {
+	return map[string]bool{
+		"hate":                   c.Hate,
+		"hate/threatening":       c.HateThreatening,
+		"harassment":             c.Harassment,
+		"harassment/threatening": c.HarassmentThreatening,
+		"self-harm":              c.SelfHarm,
+		"self-harm/intent":       c.SelfHarmIntent,
+		"self-harm/instructions": c.SelfHarmInstructions,
+		"sexual":                 c.Sexual,
+		"sexual/minors":          c.SexualMinors,
+		"violence":               c.Violence,
+		"violence/graphic":       c.ViolenceGraphic,
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var ErrNotMP4 = errors.New("not an MP4 file")
+
+// The moov box holds only sample tables; anything bigger is not a video we
+// generated.
+const maxMoovSize = 64 << 20
+
+var mp4FirstBoxes = map[string]bool{"ftyp": true, "moov": true, "mdat": true, "free": true, "skip": true, "wide": true}
+
+// VideoMetadata is what InspectMP4 reads from a video file.
+type VideoMetadata struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Width and Height are as displayed, after the track's rotation.
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	AspectRatio string  `json:"aspect_ratio"`
+	VideoCodec  string  `json:"video_codec"`
+	FrameRate   float64 `json:"frame_rate"`
+	HasAudio    bool    `json:"has_audio"`
+	AudioCodec  string  `json:"audio_codec,omitempty"`
+	SampleRate  int     `json:"sample_rate,omitempty"`
+	Channels    int     `json:"channels,omitempty"`
+	Size        int64   `json:"size"`
+	Brand       string  `json:"brand"`
+	// FastStart means the moov box comes before the media data, so the
+	// video can play before it is fully downloaded.
+	FastStart bool `json:"fast_start"`
+	EditList  bool `json:"edit_list,omitempty"`
+}
+
+type mp4Track struct {
+	handler     string
+	codec       string
+	width       int
+	height      int
+	rotated     bool
+	timescale   uint32
+	duration    uint64
+	samples     uint64
+	sampleRate  int
+	channels    int
+	hasEditList bool
+}
+
+// InspectMP4 parses the ISO-BMFF boxes of an MP4 or MOV file. The media
+// data is skipped, with Seek when r supports it.
+func InspectMP4(r io.Reader) (*VideoMetadata, error) {
+	metadata := &VideoMetadata{}
+	var moov []byte
+	seenMdat := false
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read box header: %w", err)
+		}
+		size := uint64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := uint64(8)
+		// A size of zero means the box runs to the end of the file.
+		toEnd := size == 0
+
+		if size == 1 {
+			var large [8]byte
+			if _, err := io.ReadFull(r, large[:]); err != nil {
+				return nil, fmt.Errorf("failed to read %s box size: %w", boxType, err)
+			}
+			size = binary.BigEndian.Uint64(large[:])
+			headerSize = 16
+		}
+		if !toEnd && (size < headerSize || size > math.MaxInt64) {
+			return nil, fmt.Errorf("%w: %s box has invalid size %d", ErrNotMP4, boxType, size)
+		}
+		// Older QuickTime files have no ftyp box.
+		if metadata.Size == 0 && !mp4FirstBoxes[boxType] {
+			return nil, fmt.Errorf("%w: starts with %q", ErrNotMP4, boxType)
+		}
+
+		if toEnd {
+			if boxType == "ftyp" || boxType == "moov" {
+				return nil, fmt.Errorf("%s box runs to the end of the file", boxType)
+			}
+			if boxType == "mdat" {
+				seenMdat = true
+			}
+			n, err := io.Copy(io.Discard, r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to skip %s box: %w", boxType, err)
+			}
+			metadata.Size += int64(headerSize) + n
+			continue
+		}
+
+		payloadSize := int64(size - headerSize)
+		switch boxType {
+		case "ftyp", "moov":
+			if payloadSize > maxMoovSize {
+				return nil, fmt.Errorf("%s box is too large: %d bytes", boxType, payloadSize)
+			}
+			// Read rather than allocate up front, so a size larger than
+			// the file costs no more memory than the file.
+			payload, err := io.ReadAll(io.LimitReader(r, payloadSize))
+			if err == nil && int64(len(payload)) < payloadSize {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s box: %w", boxType, err)
+			}
+			if boxType == "ftyp" {
+				if len(payload) < 4 {
+					return nil, fmt.Errorf("%w: short ftyp box", ErrNotMP4)
+				}
+				metadata.Brand = string(payload[:4])
+			} else {
+				moov = payload
+				metadata.FastStart = !seenMdat
+			}
+		default:
+			if boxType == "mdat" {
+				seenMdat = true
+			}
+			if err := skipBytes(r, payloadSize); err != nil {
+				return nil, fmt.Errorf("failed to skip %s box: %w", boxType, err)
+			}
+		}
+		metadata.Size += int64(size)
+	}
+
+	if metadata.Size == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrNotMP4)
+	}
+	if moov == nil {
+		return nil, fmt.Errorf("%w: no moov box", ErrNotMP4)
+	}
+	if err := parseMoov(moov, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// skipBytes discards the next n bytes of r, and fails with
+// io.ErrUnexpectedEOF when r has fewer left.
+func skipBytes(r io.Reader, n int64) error {
+	if n < 0 {
+		return fmt.Errorf("cannot skip %d bytes", n)
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		// Seeking past the end succeeds, so compare with the length first.
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if n > end-offset {
+			return io.ErrUnexpectedEOF
+		}
+		_, err = seeker.Seek(offset+n, io.SeekStart)
+		return err
+	}
+	copied, err := io.CopyN(io.Discard, r, n)
+	if err == io.EOF && copied < n {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// walkBoxes calls visit for each box in data.
+func walkBoxes(data []byte, visit func(boxType string, payload []byte) error) error {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fmt.Errorf("%w: truncated box header", ErrNotMP4)
+		}
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		boxType := string(data[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return fmt.Errorf("%w: truncated %s box", ErrNotMP4, boxType)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return fmt.Errorf("%w: %s box has invalid size %d", ErrNotMP4, boxType, size)
+		}
+		if err := visit(boxType, data[headerSize:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+func parseMoov(moov []byte, metadata *VideoMetadata) error {
+	var timescale uint32
+	var duration uint64
+	var tracks []*mp4Track
+
+	err := walkBoxes(moov, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "mvhd":
+			var err error
+			timescale, duration, err = parseMediaHeader(payload, 12, 20)
+			return err
+		case "trak":
+			track := &mp4Track{}
+			if err := parseTrak(payload, track); err != nil {
+				return err
+			}
+			tracks = append(tracks, track)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if timescale == 0 {
+		return fmt.Errorf("%w: no movie header", ErrNotMP4)
+	}
+	metadata.DurationSeconds = float64(duration) / float64(timescale)
+
+	for _, track := range tracks {
+		if track.hasEditList {
+			metadata.EditList = true
+		}
+		switch track.handler {
+		case "vide":
+			if metadata.VideoCodec != "" {
+				continue
+			}
+			metadata.VideoCodec = track.codec
+			metadata.Width, metadata.Height = track.width, track.height
+			if track.rotated {
+				metadata.Width, metadata.Height = track.height, track.width
+			}
+			if track.timescale > 0 && track.duration > 0 {
+				metadata.FrameRate = float64(track.samples) / (float64(track.duration) / float64(track.timescale))
+			}
+		case "soun":
+			if metadata.HasAudio {
+				continue
+			}
+			metadata.HasAudio = true
+			metadata.AudioCodec = track.codec
+			metadata.SampleRate = track.sampleRate
+			metadata.Channels = track.channels
+		}
+	}
+
+	if metadata.VideoCodec == "" {
+		return fmt.Errorf("%w: no video track", ErrNotMP4)
+	}
+	metadata.AspectRatio = aspectRatio(metadata.Width, metadata.Height)
+	return nil
+}
+
+// parseMediaHeader reads the timescale and duration of an mvhd or mdhd box,
+// whose version 0 fields start at offset0 and version 1 fields at offset1.
+func parseMediaHeader(payload []byte, offset0, offset1 int) (uint32, uint64, error) {
+	if len(payload) < 4 {
+		return 0, 0, fmt.Errorf("%w: short media header", ErrNotMP4)
+	}
+	if payload[0] == 1 {
+		if len(payload) < offset1+12 {
+			return 0, 0, fmt.Errorf("%w: short media header", ErrNotMP4)
+		}
+		return binary.BigEndian.Uint32(payload[offset1:]), binary.BigEndian.Uint64(payload[offset1+4:]), nil
+	}
+	if len(payload) < offset0+8 {
+		return 0, 0, fmt.Errorf("%w: short media header", ErrNotMP4)
+	}
+	return binary.BigEndian.Uint32(payload[offset0:]), uint64(binary.BigEndian.Uint32(payload[offset0+4:])), nil
+}
+
+func parseTrak(trak []byte, track *mp4Track) error {
+	return walkBoxes(trak, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "tkhd":
+			return parseTkhd(payload, track)
+		case "edts":
+			return walkBoxes(payload, func(boxType string, payload []byte) error {
+				// A single edit that starts at zero only trims the end,
+				// which players and Instagram handle.
+				if boxType == "elst" && len(payload) >= 8 && binary.BigEndian.Uint32(payload[4:8]) > 1 {
+					track.hasEditList = true
+				}
+				return nil
+			})
+		case "mdia":
+			return walkBoxes(payload, func(boxType string, payload []byte) error {
+				switch boxType {
+				case "mdhd":
+					var err error
+					track.timescale, track.duration, err = parseMediaHeader(payload, 12, 20)
+					return err
+				case "hdlr":
+					if len(payload) >= 12 {
+						track.handler = string(payload[8:12])
+					}
+				case "minf":
+					return walkBoxes(payload, func(boxType string, payload []byte) error {
+						if boxType == "stbl" {
+							return parseStbl(payload, track)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func parseTkhd(payload []byte, track *mp4Track) error {
+	// The matrix and size follow the version-dependent times.
+	matrixOffset := 40
+	if len(payload) > 0 && payload[0] == 1 {
+		matrixOffset = 52
+	}
+	if len(payload) < matrixOffset+44 {
+		return fmt.Errorf("%w: short track header", ErrNotMP4)
+	}
+	// A 90 or 270 degree rotation has zero on the matrix diagonal.
+	a := int32(binary.BigEndian.Uint32(payload[matrixOffset:]))
+	b := int32(binary.BigEndian.Uint32(payload[matrixOffset+4:]))
+	track.rotated = a == 0 && b != 0
+	track.width = int(binary.BigEndian.Uint32(payload[matrixOffset+36:]) >> 16)
+	track.height = int(binary.BigEndian.Uint32(payload[matrixOffset+40:]) >> 16)
+	return nil
+}
+
+func parseStbl(stbl []byte, track *mp4Track) error {
+	return walkBoxes(stbl, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "stsd":
+			if len(payload) < 8 {
+				return fmt.Errorf("%w: short sample description", ErrNotMP4)
+			}
+			// Only the first sample entry matters.
+			entries := payload[8:]
+			if len(entries) < 8 {
+				return nil
+			}
+			size := binary.BigEndian.Uint32(entries[:4])
+			if size < 8 || int(size) > len(entries) {
+				return fmt.Errorf("%w: invalid sample entry", ErrNotMP4)
+			}
+			track.codec = string(entries[4:8])
+			entry := entries[8:size]
+			switch track.handler {
+			case "vide":
+				// VisualSampleEntry: width and height after 24 bytes of
+				// reserved and pre-defined fields.
+				if len(entry) >= 28 && track.width == 0 {
+					track.width = int(binary.BigEndian.Uint16(entry[24:]))
+					track.height = int(binary.BigEndian.Uint16(entry[26:]))
+				}
+			case "soun":
+				// AudioSampleEntry: channels after 16 bytes, the 16.16
+				// sample rate after 24.
+				if len(entry) >= 28 {
+					track.channels = int(binary.BigEndian.Uint16(entry[16:]))
+					track.sampleRate = int(binary.BigEndian.Uint32(entry[24:]) >> 16)
+				}
+			}
+		case "stts":
+			if len(payload) < 8 {
+				return fmt.Errorf("%w: short time-to-sample table", ErrNotMP4)
+			}
+			count := int(binary.BigEndian.Uint32(payload[4:8]))
+			if len(payload) < 8+count*8 {
+				return fmt.Errorf("%w: truncated time-to-sample table", ErrNotMP4)
+			}
+			for i := 0; i < count; i++ {
+				track.samples += uint64(binary.BigEndian.Uint32(payload[8+i*8:]))
+			}
+		}
+		return nil
+	})
+}
+
+func aspectRatio(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return ""
+	}
+	a, b := width, height
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return fmt.Sprintf("%d:%d", width/a, height/a)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func mp4Box(boxType string, payloads ...[]byte) []byte {
+	payload := bytes.Join(payloads, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	box = append(box, boxType...)
+	return append(box, payload...)
+}
+
+// mp4LargeBox writes a box header with a 64-bit size.
+func mp4LargeBox(boxType string, size uint64, payload []byte) []byte {
+	box := binary.BigEndian.AppendUint32(nil, 1)
+	box = append(box, boxType...)
+	box = binary.BigEndian.AppendUint64(box, size)
+	return append(box, payload...)
+}
+
+// mp4FullBox prefixes payload with a version and flags.
+func mp4FullBox(boxType string, version byte, payload []byte) []byte {
+	return mp4Box(boxType, []byte{version, 0, 0, 0}, payload)
+}
+
+// mp4Fields writes 32-bit fields at the given offsets of a zeroed payload.
+func mp4Fields(size int, fields map[int]uint32) []byte {
+	payload := make([]byte, size)
+	for offset, value := range fields {
+		binary.BigEndian.PutUint32(payload[offset:], value)
+	}
+	return payload
+}
+
+func testVideoTrak(width, height int, rotated bool) []byte {
+	// The tkhd matrix starts at 40 and the 16.16 size at 76, counted from
+	// the start of the payload including version and flags.
+	matrix := map[int]uint32{36: 0x00010000, 52: 0x00010000}
+	if rotated {
+		matrix = map[int]uint32{40: 0x00010000, 48: 0xffff0000}
+	}
+	matrix[72] = uint32(width) << 16
+	matrix[76] = uint32(height) << 16
+
+	entry := make([]byte, 78)
+	binary.BigEndian.PutUint16(entry[24:], uint16(width))
+	binary.BigEndian.PutUint16(entry[26:], uint16(height))
+
+	return mp4Box("trak",
+		mp4FullBox("tkhd", 0, mp4Fields(80, matrix)),
+		mp4Box("mdia",
+			mp4FullBox("mdhd", 0, mp4Fields(20, map[int]uint32{8: 15360, 12: 8 * 15360})),
+			mp4FullBox("hdlr", 0, mp4Fields(20, map[int]uint32{4: binary.BigEndian.Uint32([]byte("vide"))})),
+			mp4Box("minf", mp4Box("stbl",
+				mp4FullBox("stsd", 0, append(binary.BigEndian.AppendUint32(nil, 1), mp4Box("avc1", entry)...)),
+				mp4FullBox("stts", 0, mp4Fields(12, map[int]uint32{0: 1, 4: 240, 8: 512})),
+			)),
+		),
+	)
+}
+
+func testAudioTrak() []byte {
+	entry := make([]byte, 28)
+	binary.BigEndian.PutUint16(entry[16:], 2)
+	binary.BigEndian.PutUint32(entry[24:], 48000<<16)
+
+	return mp4Box("trak",
+		mp4FullBox("tkhd", 0, make([]byte, 80)),
+		mp4Box("mdia",
+			mp4FullBox("mdhd", 0, mp4Fields(20, map[int]uint32{8: 48000, 12: 8 * 48000})),
+			mp4FullBox("hdlr", 0, mp4Fields(20, map[int]uint32{4: binary.BigEndian.Uint32([]byte("soun"))})),
+			mp4Box("minf", mp4Box("stbl",
+				mp4FullBox("stsd", 0, append(binary.BigEndian.AppendUint32(nil, 1), mp4Box("mp4a", entry)...)),
+			)),
+		),
+	)
+}
+
+func testMoov(tracks ...[]byte) []byte {
+	mvhd := mp4FullBox("mvhd", 0, mp4Fields(96, map[int]uint32{8: 1000, 12: 8000}))
+	return mp4Box("moov", append([][]byte{mvhd}, tracks...)...)
+}
+
+// testMP4 is an 8 second 1080x1920 H.264 video at 30 fps with stereo AAC
+// audio at 48 kHz.
+func testMP4() []byte {
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom"), make([]byte, 4), []byte("isomavc1")),
+		testMoov(testVideoTrak(1080, 1920, false), testAudioTrak()),
+		mp4Box("mdat", make([]byte, 1024)),
+	}, nil)
+}
+
+// readerOnly hides the Seek method of a reader.
+type readerOnly struct {
+	io.Reader
+}
+
+func TestInspectMP4(t *testing.T) {
+	valid := testMP4()
+	want := &VideoMetadata{
+		DurationSeconds: 8,
+		Width:           1080,
+		Height:          1920,
+		AspectRatio:     "9:16",
+		VideoCodec:      "avc1",
+		FrameRate:       30,
+		HasAudio:        true,
+		AudioCodec:      "mp4a",
+		SampleRate:      48000,
+		Channels:        2,
+		Size:            int64(len(valid)),
+		Brand:           "isom",
+		FastStart:       true,
+	}
+
+	for name, newReader := range map[string]func([]byte) io.Reader{
+		"seeker": func(data []byte) io.Reader { return bytes.NewReader(data) },
+		"stream": func(data []byte) io.Reader { return readerOnly{bytes.NewReader(data)} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := InspectMP4(newReader(valid))
+			if err != nil {
+				t.Fatalf("InspectMP4() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("InspectMP4() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestInspectMP4Layout(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("mp42"), make([]byte, 4))
+	moov := testMoov(testVideoTrak(1920, 1080, true))
+	mdat := mp4Box("mdat", make([]byte, 64))
+
+	tests := []struct {
+		name string
+		data []byte
+		want func(*VideoMetadata) bool
+	}{
+		{
+			name: "moov after mdat",
+			data: bytes.Join([][]byte{ftyp, mdat, moov}, nil),
+			want: func(m *VideoMetadata) bool { return !m.FastStart },
+		},
+		{
+			name: "rotated track",
+			data: bytes.Join([][]byte{ftyp, moov, mdat}, nil),
+			want: func(m *VideoMetadata) bool { return m.Width == 1080 && m.Height == 1920 && !m.HasAudio },
+		},
+		{
+			name: "mdat to the end of the file",
+			data: bytes.Join([][]byte{ftyp, moov, {0, 0, 0, 0}, []byte("mdat"), make([]byte, 64)}, nil),
+			want: func(m *VideoMetadata) bool { return m.Size == int64(len(ftyp)+len(moov)+72) },
+		},
+		{
+			name: "64-bit mdat size",
+			data: bytes.Join([][]byte{ftyp, moov, mp4LargeBox("mdat", 16+64, make([]byte, 64))}, nil),
+			want: func(m *VideoMetadata) bool { return m.Size == int64(len(ftyp)+len(moov)+80) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InspectMP4(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("InspectMP4() error = %v", err)
+			}
+			if !tt.want(got) {
+				t.Errorf("InspectMP4() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestInspectMP4Invalid(t *testing.T) {
+	valid := testMP4()
+	free := mp4Box("free")
+	moov := testMoov(testVideoTrak(1080, 1920, false))
+
+	tests := []struct {
+		name string
+		data []byte
+		// notMP4 means the error must match ErrNotMP4.
+		notMP4 bool
+	}{
+		{name: "empty", data: nil, notMP4: true},
+		{name: "not an MP4", data: []byte("<!DOCTYPE html><html></html>"), notMP4: true},
+		{name: "short header", data: valid[:5]},
+		{name: "size below header", data: []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}, notMP4: true},
+		{name: "64-bit size below header", data: mp4LargeBox("free", 8, nil), notMP4: true},
+		{
+			// A size that does not fit in an int64 used to seek backwards
+			// and loop forever.
+			name:   "64-bit size near 2^64",
+			data:   append(append([]byte{}, free...), mp4LargeBox("mdat", math.MaxUint64-7, nil)...),
+			notMP4: true,
+		},
+		{name: "64-bit size over MaxInt64", data: mp4LargeBox("free", math.MaxInt64+1, nil), notMP4: true},
+		{name: "box past the end", data: append(append([]byte{}, moov...), mp4LargeBox("mdat", math.MaxInt64, nil)...)},
+		{name: "truncated mdat", data: valid[:len(valid)-1]},
+		{name: "truncated moov", data: valid[:100]},
+		{name: "moov to the end", data: append([]byte{0, 0, 0, 0}, moov[4:]...)},
+		{name: "moov too large", data: mp4LargeBox("moov", maxMoovSize+17, nil)},
+		{name: "no moov", data: mp4Box("mdat", make([]byte, 16)), notMP4: true},
+		{name: "no video track", data: testMoov(testAudioTrak()), notMP4: true},
+		{name: "moov box past its parent", data: mp4Box("moov", []byte{0, 0, 0, 99}, []byte("trak")), notMP4: true},
+	}
+
+	for _, tt := range tests {
+		for name, reader := range map[string]io.Reader{
+			"seeker": bytes.NewReader(tt.data),
+			"stream": readerOnly{bytes.NewReader(tt.data)},
+		} {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				got, err := InspectMP4(reader)
+				if err == nil {
+					t.Fatalf("InspectMP4() = %+v, want an error", got)
+				}
+				if tt.notMP4 && !errors.Is(err, ErrNotMP4) {
+					t.Errorf("InspectMP4() error = %v, want ErrNotMP4", err)
+				}
+			})
+		}
+	}
+}
+
+func TestSkipBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int64
+		wantErr bool
+	}{
+		{name: "within", n: 4},
+		{name: "to the end", n: 8},
+		{name: "past the end", n: 9, wantErr: true},
+		{name: "negative", n: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		for name, reader := range map[string]io.Reader{
+			"seeker": bytes.NewReader(make([]byte, 8)),
+			"stream": readerOnly{bytes.NewReader(make([]byte, 8))},
+		} {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				err := skipBytes(reader, tt.n)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("skipBytes(%d) error = %v, want error %v", tt.n, err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestWalkBoxes(t *testing.T) {
+	type box struct {
+		boxType string
+		size    int
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []box
+		wantErr bool
+	}{
+		{name: "empty", data: nil},
+		{
+			name: "siblings",
+			data: append(mp4Box("mvhd", make([]byte, 4)), mp4Box("trak")...),
+			want: []box{{"mvhd", 4}, {"trak", 0}},
+		},
+		{
+			name: "size zero runs to the end",
+			data: append([]byte{0, 0, 0, 0}, append([]byte("udta"), make([]byte, 5)...)...),
+			want: []box{{"udta", 5}},
+		},
+		{
+			name: "64-bit size",
+			data: mp4LargeBox("udta", 16+3, make([]byte, 3)),
+			want: []box{{"udta", 3}},
+		},
+		{name: "truncated header", data: []byte{0, 0, 0, 8, 'f'}, wantErr: true},
+		{name: "truncated 64-bit size", data: []byte{0, 0, 0, 1, 'u', 'd', 't', 'a', 0}, wantErr: true},
+		{name: "size below header", data: []byte{0, 0, 0, 7, 'u', 'd', 't', 'a'}, wantErr: true},
+		{name: "size past the end", data: []byte{0, 0, 0, 9, 'u', 'd', 't', 'a'}, wantErr: true},
+		{name: "64-bit size near 2^64", data: mp4LargeBox("udta", math.MaxUint64-7, nil), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []box
+			err := walkBoxes(tt.data, func(boxType string, payload []byte) error {
+				got = append(got, box{boxType, len(payload)})
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("walkBoxes() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrNotMP4) {
+					t.Errorf("walkBoxes() error = %v, want ErrNotMP4", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("walkBoxes() visited %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzInspectMP4(f *testing.F) {
+	f.Add(testMP4())
+	f.Add(append(mp4Box("free"), mp4LargeBox("mdat", math.MaxUint64-7, nil)...))
+	f.Add(append(mp4Box("ftyp", []byte("isom")), 0, 0, 0, 0, 'm', 'd', 'a', 't'))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, reader := range []io.Reader{bytes.NewReader(data), readerOnly{bytes.NewReader(data)}} {
+			metadata, err := InspectMP4(reader)
+			if err != nil {
+				continue
+			}
+			if metadata.Size != int64(len(data)) {
+				t.Errorf("Size = %d for %d bytes", metadata.Size, len(data))
+			}
+			CheckReels(metadata)
+		}
+	})
+}
+
+func FuzzWalkBoxes(f *testing.F) {
+	f.Add(testMoov(testVideoTrak(1080, 1920, false), testAudioTrak())[8:])
+	f.Add(mp4LargeBox("udta", math.MaxUint64-7, nil))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		total := 0
+		err := walkBoxes(data, func(boxType string, payload []byte) error {
+			total += len(payload)
+			return walkBoxes(payload, func(string, []byte) error { return nil })
+		})
+		if err == nil && total > len(data) {
+			t.Errorf("payloads total %d bytes of %d", total, len(data))
+		}
+	})
+}
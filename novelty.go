@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	minHashSize   = 128
+	shingleLength = 5
+	minHashPrime  = (1 << 61) - 1
+)
+
+type PromptEmbedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+type NoveltyConfig struct {
+	Window             time.Duration
+	MinHashThreshold   float64
+	EmbeddingThreshold float64
+	MaxAttempts        int
+}
+
+type NoveltyResult struct {
+	Method          string  `json:"method"`
+	Similarity      float64 `json:"similarity"`
+	ClosestPromptID string  `json:"closest_prompt_id,omitempty"`
+	Rejections      int     `json:"rejections"`
+	Novel           bool    `json:"novel"`
+}
+
+type NoveltyReport struct {
+	Window             time.Duration
+	MinHashThreshold   float64
+	EmbeddingThreshold float64
+	Checked            int
+	Rejected           int
+	Exhausted          int
+}
+
+func (r NoveltyReport) String() string {
+	return fmt.Sprintf("novelty: %d checked, %d rejected, %d accepted after exhausting retries (window %s, minhash >= %.2f, embedding >= %.2f)",
+		r.Checked, r.Rejected, r.Exhausted, r.Window, r.MinHashThreshold, r.EmbeddingThreshold)
+}
+
+// NoveltyChecker rejects prompts that are too close to anything accepted
+// within the configured window. MinHash over character shingles is always
+// used; embeddings are added when the prompt model can produce them.
+type NoveltyChecker struct {
+	history  *PromptHistory
+	config   NoveltyConfig
+	embedder PromptEmbedder
+	report   NoveltyReport
+	mu       sync.Mutex
+	// admitMu is held from checking a candidate to adding it to the
+	// history, so concurrent batch workers see each other's prompts.
+	admitMu sync.Mutex
+}
+
+func NewNoveltyConfigFromEnv() (NoveltyConfig, error) {
+	config := NoveltyConfig{
+		Window:             30 * 24 * time.Hour,
+		MinHashThreshold:   0.5,
+		EmbeddingThreshold: 0.92,
+		MaxAttempts:        3,
+	}
+
+	if value := os.Getenv("NOVELTY_WINDOW_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			return config, fmt.Errorf("NOVELTY_WINDOW_DAYS must be a positive integer, got %q", value)
+		}
+		config.Window = time.Duration(days) * 24 * time.Hour
+	}
+
+	if value := os.Getenv("NOVELTY_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return config, fmt.Errorf("NOVELTY_THRESHOLD must be in (0, 1], got %q", value)
+		}
+		config.MinHashThreshold = threshold
+	}
+
+	if value := os.Getenv("NOVELTY_EMBEDDING_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return config, fmt.Errorf("NOVELTY_EMBEDDING_THRESHOLD must be in (0, 1], got %q", value)
+		}
+		config.EmbeddingThreshold = threshold
+	}
+
+	if value := os.Getenv("NOVELTY_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts <= 0 {
+			return config, fmt.Errorf("NOVELTY_MAX_ATTEMPTS must be a positive integer, got %q", value)
+		}
+		config.MaxAttempts = attempts
+	}
+
+	return config, nil
+}
+
+func NewNoveltyChecker(history *PromptHistory, config NoveltyConfig, model PromptModel) *NoveltyChecker {
+	nc := &NoveltyChecker{
+		history: history,
+		config:  config,
+		report: NoveltyReport{
+			Window:             config.Window,
+			MinHashThreshold:   config.MinHashThreshold,
+			EmbeddingThreshold: config.EmbeddingThreshold,
+		},
+	}
+	if embedder, ok := model.(PromptEmbedder); ok {
+		nc.embedder = embedder
+	}
+	return nc
+}
+
+type noveltyCandidate struct {
+	signature []uint32
+	embedding []float32
+}
+
+func (nc *NoveltyChecker) prepare(ctx context.Context, text string) noveltyCandidate {
+	candidate := noveltyCandidate{signature: minHashSignature(text)}
+
+	nc.mu.Lock()
+	embedder := nc.embedder
+	nc.mu.Unlock()
+
+	if embedder != nil {
+		embedding, err := embedder.Embed(ctx, text)
+		if err != nil {
+			// Local OpenAI-compatible servers often lack embeddings; stop
+			// asking and rely on MinHash for the rest of the run.
+			fmt.Printf("Embeddings unavailable, using MinHash only: %v\n", err)
+			nc.mu.Lock()
+			nc.embedder = nil
+			nc.mu.Unlock()
+		} else {
+			candidate.embedding = embedding
+		}
+	}
+
+	return candidate
+}
+
+func (nc *NoveltyChecker) check(candidate noveltyCandidate) NoveltyResult {
+	result := NoveltyResult{Method: "minhash", Novel: true}
+	cutoff := time.Now().Add(-nc.config.Window)
+
+	for _, record := range nc.history.Since(cutoff) {
+		if len(candidate.embedding) > 0 && len(record.Embedding) == len(candidate.embedding) {
+			similarity := cosineSimilarity(candidate.embedding, record.Embedding)
+			if similarity >= nc.config.EmbeddingThreshold {
+				return NoveltyResult{Method: "embedding", Similarity: similarity, ClosestPromptID: record.ID}
+			}
+		}
+
+		if len(record.Signature) != minHashSize {
+			continue
+		}
+		similarity := minHashSimilarity(candidate.signature, record.Signature)
+		if similarity > result.Similarity {
+			result.Similarity = similarity
+			result.ClosestPromptID = record.ID
+		}
+	}
+
+	result.Novel = result.Similarity < nc.config.MinHashThreshold
+	return result
+}
+
+// admit checks candidate and, if it is novel, adds it to the history in
+// the same critical section.
+func (nc *NoveltyChecker) admit(prompt *VideoPrompt, candidate noveltyCandidate) (NoveltyResult, error) {
+	nc.admitMu.Lock()
+	defer nc.admitMu.Unlock()
+
+	result := nc.check(candidate)
+	if !result.Novel {
+		return result, nil
+	}
+	return result, nc.add(prompt, candidate)
+}
+
+// remember adds a prompt to the history without checking it.
+func (nc *NoveltyChecker) remember(prompt *VideoPrompt, candidate noveltyCandidate) error {
+	nc.admitMu.Lock()
+	defer nc.admitMu.Unlock()
+	return nc.add(prompt, candidate)
+}
+
+func (nc *NoveltyChecker) add(prompt *VideoPrompt, candidate noveltyCandidate) error {
+	return nc.history.Add(PromptRecord{
+		ID:         prompt.ID,
+		Text:       prompt.Text,
+		Theme:      prompt.Theme,
+		Situation:  prompt.Situation,
+		Signature:  candidate.signature,
+		Embedding:  candidate.embedding,
+		ParentIDs:  prompt.ParentIDs,
+		Generation: prompt.Generation,
+		CreatedAt:  prompt.CreatedAt,
+	})
+}
+
+func (nc *NoveltyChecker) record(result NoveltyResult) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	nc.report.Checked++
+	if !result.Novel {
+		nc.report.Rejected++
+	}
+}
+
+func (nc *NoveltyChecker) recordExhausted() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nc.report.Exhausted++
+}
+
+func (nc *NoveltyChecker) Report() NoveltyReport {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return nc.report
+}
+
+// generateNovelPrompt regenerates until a candidate clears the similarity
+// thresholds. Each attempt draws a new selection from the prompt's draw.
+func (pg *PromptGenerator) generateNovelPrompt(ctx context.Context, nc *NoveltyChecker, req PromptRequest, draw *promptDraw) (*VideoPrompt, error) {
+	prompt, err := nc.admitNovel(ctx, func() (*VideoPrompt, error) {
+		return pg.generateCandidate(ctx, req, draw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pg.recordPrompt(prompt), nil
+}
+
+// admitNovel calls generate until a candidate clears the similarity
+// thresholds. If every attempt is rejected the least similar candidate is
+// kept so a batch never comes back short, and the miss is counted. A
+// candidate is checked and added to the history atomically, so a near
+// duplicate accepted by another worker in the meantime forces a retry.
+func (nc *NoveltyChecker) admitNovel(ctx context.Context, generate func() (*VideoPrompt, error)) (*VideoPrompt, error) {
+	var best *VideoPrompt
+	var bestCandidate noveltyCandidate
+	var bestResult NoveltyResult
+
+	for attempt := 0; attempt < nc.config.MaxAttempts; attempt++ {
+		prompt, err := generate()
+		if err != nil {
+			return nil, err
+		}
+
+		candidate := nc.prepare(ctx, prompt.Text)
+		result, err := nc.admit(prompt, candidate)
+		if err != nil {
+			fmt.Printf("Failed to record prompt history: %v\n", err)
+		}
+		result.Rejections = attempt
+		nc.record(result)
+
+		if result.Novel {
+			best, bestCandidate, bestResult = prompt, candidate, result
+			break
+		}
+
+		fmt.Printf("Rejected prompt %.2f similar (%s) to %s, regenerating\n", result.Similarity, result.Method, result.ClosestPromptID)
+		if best == nil || result.Similarity < bestResult.Similarity {
+			best, bestCandidate, bestResult = prompt, candidate, result
+		}
+	}
+
+	if !bestResult.Novel {
+		bestResult.Rejections = nc.config.MaxAttempts
+		nc.recordExhausted()
+		if err := nc.remember(best, bestCandidate); err != nil {
+			fmt.Printf("Failed to record prompt history: %v\n", err)
+		}
+	}
+
+	best.Novelty = &bestResult
+	return best, nil
+}
+
+func normalizeForShingles(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+		} else if !space {
+			b.WriteRune(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func minHashSignature(text string) []uint32 {
+	normalized := []rune(normalizeForShingles(text))
+
+	signature := make([]uint32, minHashSize)
+	for i := range signature {
+		signature[i] = math.MaxUint32
+	}
+
+	if len(normalized) < shingleLength {
+		normalized = append(normalized, []rune(strings.Repeat(" ", shingleLength-len(normalized)))...)
+	}
+
+	for i := 0; i+shingleLength <= len(normalized); i++ {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(string(normalized[i : i+shingleLength])))
+		shingle := hasher.Sum64() % minHashPrime
+
+		for j := range signature {
+			a, b := minHashCoefficients[j][0], minHashCoefficients[j][1]
+			h := uint32((mulMod(a, shingle) + b) % minHashPrime)
+			if h < signature[j] {
+				signature[j] = h
+			}
+		}
+	}
+
+	return signature
+}
+
+func minHashSimilarity(a, b []uint32) float64 {
+	matches := 0
+	for i := range a {
+		if a[i] == b[i] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(a))
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Hash coefficients are derived from a fixed seed so signatures stored in
+// the history stay comparable across runs.
+var minHashCoefficients = func() [minHashSize][2]uint64 {
+	var coefficients [minHashSize][2]uint64
+	state := uint64(0x9e3779b97f4a7c15)
+	next := func() uint64 {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		return (z ^ (z >> 31)) % minHashPrime
+	}
+	for i := range coefficients {
+		coefficients[i] = [2]uint64{next() | 1, next()}
+	}
+	return coefficients
+}()
+
+func mulMod(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	_, rem := bits.Div64(hi%minHashPrime, lo, minHashPrime)
+	return rem
+}
@@ -8,6 +8,7 @@ import (
 
 type PerformanceTracker struct {
 	performances []PostPerformance
+	listeners    []func(PostPerformance)
 	mu           sync.RWMutex
 }
 
@@ -19,8 +20,29 @@ func NewPerformanceTracker() *PerformanceTracker {
 
 func (pt *PerformanceTracker) AddPerformance(performance PostPerformance) {
 	pt.mu.Lock()
-	defer pt.mu.Unlock()
 	pt.performances = append(pt.performances, performance)
+	listeners := pt.listeners
+	pt.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(performance)
+	}
+}
+
+// Restore adds performances recorded by an earlier run without notifying
+// listeners, which saw them back then.
+func (pt *PerformanceTracker) Restore(performances []PostPerformance) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.performances = append(pt.performances, performances...)
+}
+
+// OnPerformance registers a callback invoked for every recorded
+// performance, e.g. to feed engagement back into prompt selection.
+func (pt *PerformanceTracker) OnPerformance(listener func(PostPerformance)) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.listeners = append(pt.listeners, listener)
 }
 
 func (pt *PerformanceTracker) GetBestPerformingPosts(limit int) []PostPerformance {
@@ -147,6 +169,60 @@ func (pt *PerformanceTracker) GetAnalytics() AnalyticsData {
 	}
 }
 
+// SeriesRetention reports views per posted episode of an arc relative to
+// the first episode, matching performances to episodes by prompt ID.
+func (pt *PerformanceTracker) SeriesRetention(arc *SeriesArc) []EpisodeRetention {
+	episodeByPrompt := make(map[string]int)
+	for _, episode := range arc.Episodes {
+		if episode.PromptID != "" {
+			episodeByPrompt[episode.PromptID] = episode.Number
+		}
+	}
+
+	pt.mu.RLock()
+	episodes := make(map[int]*EpisodeRetention)
+	for _, perf := range pt.performances {
+		number, ok := episodeByPrompt[perf.PromptID]
+		if !ok {
+			continue
+		}
+		episode, exists := episodes[number]
+		if !exists {
+			episode = &EpisodeRetention{EpisodeNumber: number}
+			episodes[number] = episode
+		}
+		episode.Posts++
+		episode.Views += perf.Views
+		episode.EngagementRate += perf.EngagementRate
+	}
+	pt.mu.RUnlock()
+
+	retention := make([]EpisodeRetention, 0, len(episodes))
+	for _, episode := range episodes {
+		episode.EngagementRate /= float64(episode.Posts)
+		retention = append(retention, *episode)
+	}
+	sort.Slice(retention, func(i, j int) bool {
+		return retention[i].EpisodeNumber < retention[j].EpisodeNumber
+	})
+
+	if len(retention) > 0 && retention[0].EpisodeNumber == 1 && retention[0].Views > 0 {
+		firstViews := float64(retention[0].Views)
+		for i := range retention {
+			retention[i].Retention = float64(retention[i].Views) / firstViews
+		}
+	}
+	return retention
+}
+
+type EpisodeRetention struct {
+	EpisodeNumber  int     `json:"episode_number"`
+	Posts          int     `json:"posts"`
+	Views          int     `json:"views"`
+	EngagementRate float64 `json:"engagement_rate"`
+	Retention      float64 `json:"retention"`
+}
+
 type AnalyticsData struct {
 	TotalPosts            int               `json:"total_posts"`
 	TotalViews            int               `json:"total_views"`
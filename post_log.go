@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PostRecord is one published post and, once it has been measured, its
+// performance.
+type PostRecord struct {
+	PostID      string           `json:"post_id"`
+	AccountID   string           `json:"account_id"`
+	PromptID    string           `json:"prompt_id,omitempty"`
+	VideoID     string           `json:"video_id,omitempty"`
+	PostedAt    time.Time        `json:"posted_at"`
+	Performance *PostPerformance `json:"performance,omitempty"`
+}
+
+// PostLog is an append-only JSON Lines log of published posts. A post is
+// appended when it goes up and again when its performance is measured; the
+// last line for a post wins.
+type PostLog struct {
+	path string
+	// settle is how long a post collects engagement before it is measured.
+	settle  time.Duration
+	records []PostRecord
+	index   map[string]int
+	mu      sync.RWMutex
+}
+
+// NewPostLogFromEnv loads the log at POST_LOG_PATH, or post_log.jsonl
+// next to PROMPT_HISTORY_PATH, measuring posts POST_METRICS_DELAY_HOURS
+// after they went up (default 24). It returns nil when neither is set.
+func NewPostLogFromEnv() (*PostLog, error) {
+	path := os.Getenv("POST_LOG_PATH")
+	if path == "" {
+		historyPath := os.Getenv("PROMPT_HISTORY_PATH")
+		if historyPath == "" {
+			return nil, nil
+		}
+		path = filepath.Join(filepath.Dir(historyPath), "post_log.jsonl")
+	}
+
+	settle := 24 * time.Hour
+	if value := os.Getenv("POST_METRICS_DELAY_HOURS"); value != "" {
+		hours, err := strconv.ParseFloat(value, 64)
+		if err != nil || hours < 0 {
+			return nil, fmt.Errorf("POST_METRICS_DELAY_HOURS must be a non-negative number, got %q", value)
+		}
+		settle = time.Duration(hours * float64(time.Hour))
+	}
+
+	return LoadPostLog(path, settle)
+}
+
+func LoadPostLog(path string, settle time.Duration) (*PostLog, error) {
+	l := &PostLog{
+		path:   path,
+		settle: settle,
+		index:  make(map[string]int),
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open post log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record PostRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode post log line %d: %w", line, err)
+		}
+		l.put(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read post log: %w", err)
+	}
+
+	return l, nil
+}
+
+func (l *PostLog) Add(record PostRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode post record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if dir := filepath.Dir(l.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create post log directory: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open post log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append post log: %w", err)
+	}
+
+	l.put(record)
+	return nil
+}
+
+func (l *PostLog) put(record PostRecord) {
+	if i, ok := l.index[record.PostID]; ok {
+		l.records[i] = record
+		return
+	}
+	l.index[record.PostID] = len(l.records)
+	l.records = append(l.records, record)
+}
+
+// Performances returns the performance of every measured post.
+func (l *PostLog) Performances() []PostPerformance {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	performances := make([]PostPerformance, 0, len(l.records))
+	for _, record := range l.records {
+		if record.Performance != nil {
+			performances = append(performances, *record.Performance)
+		}
+	}
+	return performances
+}
+
+// Due returns the posts that have not been measured yet and went up at
+// least the settle delay before now.
+func (l *PostLog) Due(now time.Time) []PostRecord {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	cutoff := now.Add(-l.settle)
+	due := make([]PostRecord, 0)
+	for _, record := range l.records {
+		if record.Performance == nil && !record.PostedAt.After(cutoff) {
+			due = append(due, record)
+		}
+	}
+	return due
+}
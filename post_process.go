@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// PostProcessStepConfig is one step of a pipeline; exactly one field is
+// set.
+type PostProcessStepConfig struct {
+	Watermark *WatermarkStep `yaml:"watermark"`
+	Caption   *CaptionStep   `yaml:"caption"`
+	Trim      *TrimStep      `yaml:"trim"`
+	Loop      *LoopStep      `yaml:"loop"`
+	Outro     *OutroStep     `yaml:"outro"`
+}
+
+// PostProcessConfig holds the pipeline for each account. Accounts not
+// listed get Default; an empty list turns post-processing off for an
+// account.
+type PostProcessConfig struct {
+	// Font is a TrueType file for text steps; ffmpeg's default font is
+	// used when it is empty.
+	Font     string                             `yaml:"font"`
+	Default  []PostProcessStepConfig            `yaml:"default"`
+	Accounts map[string][]PostProcessStepConfig `yaml:"accounts"`
+}
+
+func LoadPostProcessConfig(path string) (*PostProcessConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read post-processing config: %w", err)
+	}
+
+	var config PostProcessConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse post-processing config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+func (c PostProcessStepConfig) step() (postProcessStep, error) {
+	var steps []postProcessStep
+	if c.Watermark != nil {
+		steps = append(steps, c.Watermark)
+	}
+	if c.Caption != nil {
+		steps = append(steps, c.Caption)
+	}
+	if c.Trim != nil {
+		steps = append(steps, c.Trim)
+	}
+	if c.Loop != nil {
+		steps = append(steps, c.Loop)
+	}
+	if c.Outro != nil {
+		steps = append(steps, c.Outro)
+	}
+	if len(steps) != 1 {
+		return nil, fmt.Errorf("each step must be exactly one of watermark, caption, trim, loop or outro")
+	}
+	if err := steps[0].validate(); err != nil {
+		return nil, err
+	}
+	return steps[0], nil
+}
+
+// ffmpegOutputArgs encode every step's output as H.264 and AAC with the
+// moov box first, as Reels expect.
+var ffmpegOutputArgs = []string{
+	"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-pix_fmt", "yuv420p",
+	"-c:a", "aac", "-b:a", "128k", "-ar", "48000",
+	"-movflags", "+faststart",
+}
+
+// PostProcessor runs each account's pipeline on a video before it is
+// posted there. Every step is an ffmpeg run on the previous step's output,
+// and the result is stored as a new asset version of the original.
+type PostProcessor struct {
+	font     string
+	defaults []postProcessStep
+	accounts map[string][]postProcessStep
+	assets   *AssetStore
+	ffmpeg   string
+	warnOnce sync.Once
+}
+
+func NewPostProcessor(config *PostProcessConfig, assets *AssetStore) (*PostProcessor, error) {
+	if assets == nil {
+		return nil, fmt.Errorf("post-processing needs an asset store for the processed versions")
+	}
+	if assets.PublicURL() == "" {
+		return nil, fmt.Errorf("post-processing needs ASSET_PUBLIC_URL so Instagram can fetch processed videos")
+	}
+	if config.Font != "" {
+		if err := filterValue("font", config.Font); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &PostProcessor{
+		font:     config.Font,
+		accounts: make(map[string][]postProcessStep),
+		assets:   assets,
+	}
+
+	var err error
+	if p.defaults, err = postProcessSteps(config.Default); err != nil {
+		return nil, fmt.Errorf("default post-processing: %w", err)
+	}
+	for accountID, steps := range config.Accounts {
+		if p.accounts[accountID], err = postProcessSteps(steps); err != nil {
+			return nil, fmt.Errorf("post-processing for %s: %w", accountID, err)
+		}
+	}
+
+	// Without ffmpeg videos are posted as generated.
+	p.ffmpeg = os.Getenv("FFMPEG_PATH")
+	if p.ffmpeg == "" {
+		p.ffmpeg, _ = exec.LookPath("ffmpeg")
+	}
+	return p, nil
+}
+
+func postProcessSteps(configs []PostProcessStepConfig) ([]postProcessStep, error) {
+	steps := make([]postProcessStep, 0, len(configs))
+	for i, config := range configs {
+		step, err := config.step()
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// NewPostProcessorFromEnv loads POSTPROCESS_CONFIG_PATH. It returns nil when
+// it is unset.
+func NewPostProcessorFromEnv(assets *AssetStore) (*PostProcessor, error) {
+	path := os.Getenv("POSTPROCESS_CONFIG_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	config, err := LoadPostProcessConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewPostProcessor(config, assets)
+}
+
+// Available reports whether ffmpeg was found.
+func (p *PostProcessor) Available() bool {
+	return p.ffmpeg != ""
+}
+
+func (p *PostProcessor) stepsFor(accountID string) []postProcessStep {
+	if steps, ok := p.accounts[accountID]; ok {
+		return steps
+	}
+	return p.defaults
+}
+
+// Process returns the account's version of video, or video itself when the
+// account has no steps or ffmpeg is not installed.
+func (p *PostProcessor) Process(ctx context.Context, video *GeneratedVideo, account *InstagramAccount) (*GeneratedVideo, error) {
+	steps := p.stepsFor(account.ID)
+	if len(steps) == 0 {
+		return video, nil
+	}
+	if !p.Available() {
+		p.warnOnce.Do(func() {
+			fmt.Println("Warning: ffmpeg not found, posting videos without post-processing")
+		})
+		return video, nil
+	}
+
+	workDir, err := os.MkdirTemp("", "postprocess-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create post-processing directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	in := postProcessInput{video: video, account: account, font: p.font, workDir: workDir}
+	if in.path, err = p.source(ctx, video, workDir); err != nil {
+		return nil, err
+	}
+	if in.metadata, err = inspectFile(in.path); err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for i, step := range steps {
+		args, err := step.ffmpegArgs(in)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", step.name(), err)
+		}
+		if args == nil {
+			continue
+		}
+
+		out := filepath.Join(workDir, fmt.Sprintf("step-%d.mp4", i+1))
+		if err := p.run(ctx, step.name(), args, out); err != nil {
+			return nil, err
+		}
+		if in.metadata, err = inspectFile(out); err != nil {
+			return nil, fmt.Errorf("%s produced an unreadable video: %w", step.name(), err)
+		}
+		in.path = out
+		applied = append(applied, step.name())
+	}
+	if len(applied) == 0 {
+		return video, nil
+	}
+
+	return p.store(ctx, video, account, in, applied)
+}
+
+// source writes the original video to a file ffmpeg can read.
+func (p *PostProcessor) source(ctx context.Context, video *GeneratedVideo, workDir string) (string, error) {
+	var body io.ReadCloser
+	var err error
+	switch {
+	case video.AssetSHA256 != "":
+		body, err = p.assets.Open(ctx, video.AssetSHA256)
+	case video.LocalPath != "":
+		return video.LocalPath, nil
+	default:
+		body, err = downloadVideo(ctx, video.VideoURL)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read video %s: %w", video.ID, err)
+	}
+	defer body.Close()
+
+	path := filepath.Join(workDir, "source.mp4")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+	if _, err := file.ReadFrom(body); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+func (p *PostProcessor) run(ctx context.Context, step string, args []string, out string) error {
+	args = append([]string{"-hide_banner", "-loglevel", "error", "-y"}, args...)
+	args = append(append(args, ffmpegOutputArgs...), out)
+
+	started := time.Now()
+	output, err := exec.CommandContext(ctx, p.ffmpeg, args...).CombinedOutput()
+	if err != nil {
+		message := strings.TrimSpace(string(output))
+		if len(message) > 2000 {
+			message = message[len(message)-2000:]
+		}
+		return fmt.Errorf("ffmpeg %s step failed: %w: %s", step, err, message)
+	}
+	fmt.Printf("Post-processing: %s took %v\n", step, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func (p *PostProcessor) store(ctx context.Context, video *GeneratedVideo, account *InstagramAccount, in postProcessInput, applied []string) (*GeneratedVideo, error) {
+	file, err := os.Open(in.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open processed video: %w", err)
+	}
+	defer file.Close()
+
+	version := *video
+	version.ID = uuid.New().String()
+	asset, err := p.assets.Put(ctx, file, AssetMetadata{
+		VideoID:   version.ID,
+		PromptID:  video.PromptID,
+		Provider:  video.Provider,
+		SourceURL: video.VideoURL,
+		Parent:    video.AssetSHA256,
+		Account:   account.ID,
+		Steps:     applied,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	version.AssetSHA256 = asset.SHA256
+	version.VideoURL = p.assets.URL(asset.SHA256)
+	version.LocalPath = ""
+	version.Metadata = in.metadata
+	version.Duration = int(math.Round(in.metadata.DurationSeconds))
+	version.CreatedAt = time.Now()
+	fmt.Printf("Post-processed video %s for @%s (%s): %s\n", video.ID, account.Username, strings.Join(applied, ", "), asset.SHA256)
+	return &version, nil
+}
+
+func inspectFile(path string) (*VideoMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return InspectMP4(file)
+}
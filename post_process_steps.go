@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// postProcessStep turns one video file into another with a single ffmpeg
+// run. ffmpegArgs returns the input and filter arguments; the processor
+// adds the output encoding. A step with nothing to do returns nil.
+type postProcessStep interface {
+	name() string
+	validate() error
+	ffmpegArgs(in postProcessInput) ([]string, error)
+}
+
+type postProcessInput struct {
+	path     string
+	metadata *VideoMetadata
+	video    *GeneratedVideo
+	account  *InstagramAccount
+	font     string
+	// workDir holds the files a step writes for ffmpeg, such as text.
+	workDir string
+}
+
+// expand replaces {username} in configured text.
+func (in postProcessInput) expand(text string) string {
+	return strings.ReplaceAll(text, "{username}", in.account.Username)
+}
+
+var ffmpegSafeValue = regexp.MustCompile(`^[A-Za-z0-9#@._/ -]+$`)
+
+// filterValue rejects values that would need escaping inside an ffmpeg
+// filter graph.
+func filterValue(field, value string) error {
+	if !ffmpegSafeValue.MatchString(value) {
+		return fmt.Errorf("%s %q may only contain letters, digits, spaces and #@._/-", field, value)
+	}
+	return nil
+}
+
+// drawtext builds a drawtext filter. The text goes through a file so it
+// needs no escaping, and expansion is off so % is literal.
+func (in postProcessInput) drawtext(name, text string, size int, x, y string, extra string) (string, error) {
+	path := filepath.Join(in.workDir, name+".txt")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s text: %w", name, err)
+	}
+	if err := filterValue("work directory", in.workDir); err != nil {
+		return "", err
+	}
+
+	filter := fmt.Sprintf("drawtext=textfile=%s:expansion=none:fontsize=%d:fontcolor=white:x=%s:y=%s", path, size, x, y)
+	if in.font != "" {
+		filter += ":fontfile=" + in.font
+	}
+	return filter + extra, nil
+}
+
+// wrapText breaks text into lines of at most width characters, since
+// drawtext does not wrap.
+func wrapText(text string, width int) string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type WatermarkStep struct {
+	// Image is a PNG overlaid on the video; Text is drawn instead when no
+	// image is set. Text may use {username}.
+	Image string `yaml:"image"`
+	Text  string `yaml:"text"`
+	// Position is top-left, top-right, bottom-left or bottom-right (the
+	// default).
+	Position string  `yaml:"position"`
+	Opacity  float64 `yaml:"opacity"`
+	Margin   int     `yaml:"margin"`
+	Size     int     `yaml:"size"`
+}
+
+func (s *WatermarkStep) name() string { return "watermark" }
+
+func (s *WatermarkStep) validate() error {
+	if (s.Image == "") == (s.Text == "") {
+		return fmt.Errorf("watermark needs either an image or text")
+	}
+	if s.Image != "" {
+		if _, err := os.Stat(s.Image); err != nil {
+			return fmt.Errorf("watermark image: %w", err)
+		}
+	}
+	switch s.Position {
+	case "":
+		s.Position = "bottom-right"
+	case "top-left", "top-right", "bottom-left", "bottom-right":
+	default:
+		return fmt.Errorf("watermark position must be top-left, top-right, bottom-left or bottom-right, got %q", s.Position)
+	}
+	if s.Opacity == 0 {
+		s.Opacity = 0.8
+	}
+	if s.Opacity < 0 || s.Opacity > 1 {
+		return fmt.Errorf("watermark opacity must be between 0 and 1")
+	}
+	if s.Margin == 0 {
+		s.Margin = 24
+	}
+	if s.Size == 0 {
+		s.Size = 36
+	}
+	return nil
+}
+
+func (s *WatermarkStep) ffmpegArgs(in postProcessInput) ([]string, error) {
+	// x and y for a w by h mark in a W by H frame.
+	left, top := fmt.Sprint(s.Margin), fmt.Sprint(s.Margin)
+	right, bottom := fmt.Sprintf("W-w-%d", s.Margin), fmt.Sprintf("H-h-%d", s.Margin)
+	x, y := right, bottom
+	switch s.Position {
+	case "top-left":
+		x, y = left, top
+	case "top-right":
+		y = top
+	case "bottom-left":
+		x = left
+	}
+
+	if s.Image != "" {
+		filter := fmt.Sprintf("[1:v]format=rgba,colorchannelmixer=aa=%.2f[mark];[0:v][mark]overlay=%s:%s[v]", s.Opacity, x, y)
+		return []string{"-i", in.path, "-i", s.Image, "-filter_complex", filter, "-map", "[v]", "-map", "0:a?"}, nil
+	}
+
+	// drawtext names the frame w and h and the text text_w and text_h.
+	replacer := strings.NewReplacer("W-w", "w-text_w", "H-h", "h-text_h")
+	filter, err := in.drawtext("watermark", in.expand(s.Text), s.Size, replacer.Replace(x), replacer.Replace(y),
+		fmt.Sprintf(":alpha=%.2f:shadowcolor=black@0.6:shadowx=2:shadowy=2", s.Opacity))
+	if err != nil {
+		return nil, err
+	}
+	return []string{"-i", in.path, "-vf", filter}, nil
+}
+
+type CaptionStep struct {
+	// Text defaults to the content package's on-screen text for the
+	// account's locale. The step is skipped when there is none.
+	Text string `yaml:"text"`
+	// Position is top, center or bottom (the default). Top and bottom keep
+	// clear of the Reels interface.
+	Position string `yaml:"position"`
+	Size     int    `yaml:"size"`
+	// Width is the most characters per line.
+	Width int `yaml:"width"`
+}
+
+func (s *CaptionStep) name() string { return "caption" }
+
+func (s *CaptionStep) validate() error {
+	switch s.Position {
+	case "":
+		s.Position = "bottom"
+	case "top", "center", "bottom":
+	default:
+		return fmt.Errorf("caption position must be top, center or bottom, got %q", s.Position)
+	}
+	if s.Size == 0 {
+		s.Size = 48
+	}
+	if s.Width == 0 {
+		s.Width = 28
+	}
+	return nil
+}
+
+func (s *CaptionStep) ffmpegArgs(in postProcessInput) ([]string, error) {
+	text := in.expand(s.Text)
+	if text == "" && in.video.Content != nil {
+		text = in.video.Content.ForLocale(in.account.Locale).OnScreenText
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	y := "h-text_h-h*0.2"
+	switch s.Position {
+	case "top":
+		y = "h*0.12"
+	case "center":
+		y = "(h-text_h)/2"
+	}
+	filter, err := in.drawtext("caption", wrapText(text, s.Width), s.Size, "(w-text_w)/2", y,
+		":line_spacing=8:box=1:boxcolor=black@0.5:boxborderw=16")
+	if err != nil {
+		return nil, err
+	}
+	return []string{"-i", in.path, "-vf", filter}, nil
+}
+
+type TrimStep struct {
+	// Start is where the output begins, in seconds. Duration limits its
+	// length; zero keeps everything after Start.
+	Start    float64 `yaml:"start"`
+	Duration float64 `yaml:"duration"`
+}
+
+func (s *TrimStep) name() string { return "trim" }
+
+func (s *TrimStep) validate() error {
+	if s.Start < 0 || s.Duration < 0 {
+		return fmt.Errorf("trim start and duration must not be negative")
+	}
+	if s.Start == 0 && s.Duration == 0 {
+		return fmt.Errorf("trim needs a start or a duration")
+	}
+	return nil
+}
+
+func (s *TrimStep) ffmpegArgs(in postProcessInput) ([]string, error) {
+	if s.Start >= in.metadata.DurationSeconds {
+		return nil, fmt.Errorf("trim start %.2fs is past the end of the %.2fs video", s.Start, in.metadata.DurationSeconds)
+	}
+	args := []string{"-ss", fmt.Sprintf("%.3f", s.Start), "-i", in.path}
+	if s.Duration > 0 {
+		args = append(args, "-t", fmt.Sprintf("%.3f", s.Duration))
+	}
+	return args, nil
+}
+
+type LoopStep struct {
+	// Crossfade is how many seconds of the start are blended into the end
+	// so the Reel loops without a visible cut. The output is that much
+	// shorter.
+	Crossfade float64 `yaml:"crossfade"`
+}
+
+func (s *LoopStep) name() string { return "loop" }
+
+func (s *LoopStep) validate() error {
+	if s.Crossfade == 0 {
+		s.Crossfade = 0.5
+	}
+	if s.Crossfade < 0 {
+		return fmt.Errorf("loop crossfade must not be negative")
+	}
+	return nil
+}
+
+func (s *LoopStep) ffmpegArgs(in postProcessInput) ([]string, error) {
+	fade := s.Crossfade
+	length := in.metadata.DurationSeconds
+	if length <= 2*fade {
+		return nil, fmt.Errorf("a %.2fs video is too short for a %.2fs loop crossfade", length, fade)
+	}
+
+	// Play from fade onwards and blend the last fade seconds into the
+	// first fade seconds, so the final frame is the new first frame.
+	filter := fmt.Sprintf("[0:v]split[body][head];"+
+		"[body]trim=start=%[1]f,setpts=PTS-STARTPTS[vbody];"+
+		"[head]trim=end=%[1]f,setpts=PTS-STARTPTS[vhead];"+
+		"[vbody][vhead]xfade=transition=fade:duration=%[1]f:offset=%[2]f[v]", fade, length-2*fade)
+	args := []string{"-i", in.path}
+	if !in.metadata.HasAudio {
+		return append(args, "-filter_complex", filter, "-map", "[v]"), nil
+	}
+
+	filter += fmt.Sprintf(";[0:a]asplit[abody][ahead];"+
+		"[abody]atrim=start=%[1]f,asetpts=PTS-STARTPTS[abody2];"+
+		"[ahead]atrim=end=%[1]f,asetpts=PTS-STARTPTS[ahead2];"+
+		"[abody2][ahead2]acrossfade=d=%[1]f[a]", fade)
+	return append(args, "-filter_complex", filter, "-map", "[v]", "-map", "[a]"), nil
+}
+
+type OutroStep struct {
+	// Image is shown as the card, or Text (which may use {username}) is
+	// drawn on Background.
+	Image      string  `yaml:"image"`
+	Text       string  `yaml:"text"`
+	Background string  `yaml:"background"`
+	Duration   float64 `yaml:"duration"`
+	Size       int     `yaml:"size"`
+}
+
+func (s *OutroStep) name() string { return "outro" }
+
+func (s *OutroStep) validate() error {
+	if (s.Image == "") == (s.Text == "") {
+		return fmt.Errorf("outro needs either an image or text")
+	}
+	if s.Image != "" {
+		if _, err := os.Stat(s.Image); err != nil {
+			return fmt.Errorf("outro image: %w", err)
+		}
+	}
+	if s.Background == "" {
+		s.Background = "black"
+	}
+	if err := filterValue("outro background", s.Background); err != nil {
+		return err
+	}
+	if s.Duration == 0 {
+		s.Duration = 1.5
+	}
+	if s.Duration < 0 {
+		return fmt.Errorf("outro duration must not be negative")
+	}
+	if s.Size == 0 {
+		s.Size = 64
+	}
+	return nil
+}
+
+func (s *OutroStep) ffmpegArgs(in postProcessInput) ([]string, error) {
+	width, height, fps := in.metadata.Width, in.metadata.Height, in.metadata.FrameRate
+	duration := fmt.Sprintf("%.3f", s.Duration)
+
+	args := []string{"-i", in.path}
+	var card string
+	if s.Image != "" {
+		args = append(args, "-loop", "1", "-t", duration, "-i", s.Image)
+		card = fmt.Sprintf("[1:v]scale=%[1]d:%[2]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[2]d:(ow-iw)/2:(oh-ih)/2:color=%[3]s,", width, height, s.Background)
+	} else {
+		args = append(args, "-f", "lavfi", "-t", duration, "-i", fmt.Sprintf("color=c=%s:s=%dx%d", s.Background, width, height))
+		text, err := in.drawtext("outro", wrapText(in.expand(s.Text), 20), s.Size, "(w-text_w)/2", "(h-text_h)/2", ":line_spacing=12")
+		if err != nil {
+			return nil, err
+		}
+		card = "[1:v]" + text + ","
+	}
+
+	// concat needs both parts in the same size, rate and pixel format.
+	filter := fmt.Sprintf("[0:v]setsar=1,fps=%.3f,format=yuv420p[main];%ssetsar=1,fps=%.3f,format=yuv420p[card];", fps, card, fps)
+	if !in.metadata.HasAudio {
+		filter += "[main][card]concat=n=2:v=1:a=0[v]"
+		return append(args, "-filter_complex", filter, "-map", "[v]"), nil
+	}
+
+	args = append(args, "-f", "lavfi", "-t", duration, "-i", "anullsrc=r=48000:cl=stereo")
+	filter += "[0:a]aformat=sample_rates=48000:channel_layouts=stereo[mainaudio];" +
+		"[main][mainaudio][card][2:a]concat=n=2:v=1:a=1[v][a]"
+	return append(args, "-filter_complex", filter, "-map", "[v]", "-map", "[a]"), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	openai "github.com/sashabaranov/go-openai"
+	"google.golang.org/grpc/codes"
+)
+
+// Prompt model failures are tagged with one of these so callers can react
+// with errors.Is whatever backend produced them.
+var (
+	ErrRateLimited     = errors.New("prompt model rate limited")
+	ErrAuth            = errors.New("prompt model authentication failed")
+	ErrQuotaExceeded   = errors.New("prompt model quota exceeded")
+	ErrContentFiltered = errors.New("prompt model content filtered")
+)
+
+type PromptSource string
+
+const (
+	PromptSourceLLM      PromptSource = "llm"
+	PromptSourceFallback PromptSource = "fallback"
+	PromptSourceManual   PromptSource = "manual"
+	PromptSourceEvolved  PromptSource = "evolved"
+)
+
+// classifyModelError wraps err with the sentinel for its cause. Errors
+// that match none of them are returned unchanged.
+func classifyModelError(err error) error {
+	kind := modelErrorKind(err)
+	if kind == nil || errors.Is(err, kind) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+func modelErrorKind(err error) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		switch fmt.Sprint(apiErr.Code) {
+		case "insufficient_quota":
+			return ErrQuotaExceeded
+		case "content_filter", "content_policy_violation":
+			return ErrContentFiltered
+		case "invalid_api_key":
+			return ErrAuth
+		}
+		return errorKindForStatus(apiErr.HTTPStatusCode)
+	}
+
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return errorKindForStatus(requestErr.HTTPStatusCode)
+	}
+
+	var blockedErr *genai.BlockedError
+	if errors.As(err, &blockedErr) {
+		return ErrContentFiltered
+	}
+
+	var googleErr *apierror.APIError
+	if errors.As(err, &googleErr) {
+		if googleErr.Reason() == "API_KEY_INVALID" {
+			return ErrAuth
+		}
+		if status := googleErr.GRPCStatus(); status != nil {
+			switch status.Code() {
+			case codes.Unauthenticated, codes.PermissionDenied:
+				return ErrAuth
+			case codes.ResourceExhausted:
+				// Gemini reports per-minute limits and exhausted free
+				// tiers the same way; both clear up eventually.
+				return ErrRateLimited
+			}
+		}
+		return errorKindForStatus(googleErr.HTTPCode())
+	}
+
+	return nil
+}
+
+func errorKindForStatus(status int) error {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAuth
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+	return nil
+}
@@ -2,102 +2,489 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	openai "github.com/sashabaranov/go-openai"
 )
 
 type PromptGenerator struct {
-	client *openai.Client
-	themes []string
-	situations []string
+	model      PromptModel
+	catalog    *PromptCatalog
+	bandit     *PromptBandit
+	novelty    *NoveltyChecker
+	characters *CharacterRegistry
+	trends     *TrendPool
+	strict     bool
+	batch      PromptBatchConfig
+	limiter    *tokenBucket
+	seed       int64
+	rng        *rand.Rand
+	run        *RunLog
+	budget     *Budget
+	mu         sync.RWMutex
 }
 
-func NewPromptGenerator(apiKey string) *PromptGenerator {
+type PromptBatchConfig struct {
+	Workers           int
+	RequestsPerSecond float64
+	MaxRetries        int
+}
+
+// PromptRequest narrows what a generated prompt is about. The zero value
+// means "anything from the catalog".
+type PromptRequest struct {
+	AccountID    string
+	CharacterIDs []string
+}
+
+type PromptResult struct {
+	Index  int
+	Prompt *VideoPrompt
+	Err    error
+}
+
+func NewPromptGenerator(model PromptModel) *PromptGenerator {
+	batch := DefaultPromptBatchConfig()
+	seed := time.Now().UnixNano()
 	return &PromptGenerator{
-		client: openai.NewClient(apiKey),
-		themes: []string{
-			"existential dread",
-			"corporate middle management",
-			"gen z slang misuse",
-			"cryptocurrency obsession",
-			"wellness influencer parody",
-			"linkedin motivational posts",
-			"artisanal everything",
-			"sustainable living anxiety",
-			"dating app failures",
-			"work from home chaos",
-		},
-		situations: []string{
-			"realizes they've been eating the same cardboard for 3 years",
-			"discovers their humans are just large, hairless cats",
-			"starts a podcast about the futility of chasing laser dots",
-			"becomes a life coach for other cats",
-			"opens a meditation retreat for anxious house pets",
-			"launches a startup selling cardboard boxes as premium furniture",
-			"writes passive-aggressive emails to their food dispenser",
-			"practices mindfulness while knocking things off tables",
-			"develops an elaborate conspiracy theory about vacuum cleaners",
-			"starts a support group for cats with imposter syndrome",
-		},
+		model:   model,
+		catalog: DefaultPromptCatalog(),
+		batch:   batch,
+		limiter: newTokenBucket(batch.RequestsPerSecond, batch.Workers),
+		seed:    seed,
+		rng:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+func DefaultPromptBatchConfig() PromptBatchConfig {
+	return PromptBatchConfig{
+		Workers:           4,
+		RequestsPerSecond: 2,
+		MaxRetries:        3,
 	}
 }
 
+func NewPromptBatchConfigFromEnv() (PromptBatchConfig, error) {
+	config := DefaultPromptBatchConfig()
+
+	if value := os.Getenv("PROMPT_WORKERS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers <= 0 {
+			return config, fmt.Errorf("PROMPT_WORKERS must be a positive integer, got %q", value)
+		}
+		config.Workers = workers
+	}
+
+	if value := os.Getenv("PROMPT_REQUESTS_PER_SECOND"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return config, fmt.Errorf("PROMPT_REQUESTS_PER_SECOND must be a positive number, got %q", value)
+		}
+		config.RequestsPerSecond = rate
+	}
+
+	return config, nil
+}
+
+func (pg *PromptGenerator) SetBatchConfig(config PromptBatchConfig) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.batch = config
+	pg.limiter = newTokenBucket(config.RequestsPerSecond, config.Workers)
+}
+
 func (pg *PromptGenerator) GeneratePrompt(ctx context.Context) (*VideoPrompt, error) {
-	theme := pg.themes[rand.Intn(len(pg.themes))]
-	situation := pg.situations[rand.Intn(len(pg.situations))]
-
-	systemPrompt := "You are a creative director for post-ironic cat content. Generate absurd, slightly meta video prompts that combine internet culture with cat behavior. Keep it weird but family-friendly."
-	userPrompt := fmt.Sprintf("Create a short video prompt (1-2 sentences) about a cat dealing with \"%s\" where the cat %s. Make it absurd and slightly self-aware.", theme, situation)
-
-	resp, err := pg.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: openai.GPT4oMini,
-		Messages: []openai.ChatCompletionMessage{
-			{Role: openai.ChatMessageRoleSystem, Content: systemPrompt},
-			{Role: openai.ChatMessageRoleUser, Content: userPrompt},
-		},
-		MaxTokens:   150,
+	return pg.GeneratePromptFor(ctx, PromptRequest{})
+}
+
+func (pg *PromptGenerator) GeneratePromptFor(ctx context.Context, req PromptRequest) (*VideoPrompt, error) {
+	return pg.generatePrompt(ctx, req, pg.nextSeed())
+}
+
+// generatePrompt makes every random choice for one prompt from its own
+// seed, so the selection path does not depend on what other workers drew.
+func (pg *PromptGenerator) generatePrompt(ctx context.Context, req PromptRequest, seed int64) (*VideoPrompt, error) {
+	pg.mu.RLock()
+	novelty, run := pg.novelty, pg.run
+	pg.mu.RUnlock()
+
+	draw := newPromptDraw(seed)
+
+	var prompt *VideoPrompt
+	var err error
+	if novelty != nil {
+		prompt, err = pg.generateNovelPrompt(ctx, novelty, req, draw)
+	} else {
+		prompt, err = pg.generateCandidate(ctx, req, draw)
+		if err == nil {
+			prompt = pg.recordPrompt(prompt)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if run != nil {
+		if err := run.Record(prompt, req, draw); err != nil {
+			fmt.Printf("Failed to record prompt in run log: %v\n", err)
+		}
+	}
+	return prompt, nil
+}
+
+func (pg *PromptGenerator) generateCandidate(ctx context.Context, req PromptRequest, draw *promptDraw) (*VideoPrompt, error) {
+	pg.mu.RLock()
+	strict, budget := pg.strict, pg.budget
+	pg.mu.RUnlock()
+
+	selection, trend, characters, err := pg.selectPrompt(req, draw)
+	if err != nil {
+		return nil, err
+	}
+	theme, situation := selection.Theme, selection.Situation
+
+	systemPrompt := "You are a creative director for post-ironic cat content. Generate absurd, slightly meta video prompts that combine internet culture with cat behavior. Keep it weird but family-friendly. Every video ships as a content package: the video prompt, what the video model must avoid, an Instagram caption and hashtags written for this exact video, alt text, and a short shot list that fits in 8 seconds."
+	userPrompt := fmt.Sprintf("Create a content package for a video about a cat dealing with \"%s\" where the cat %s. The video prompt should be 1-2 sentences, absurd and slightly self-aware.", theme, situation)
+
+	if trend != nil {
+		userPrompt += " The theme is a current trend: riff on it from the cat's point of view without mocking real people."
+	}
+
+	systemPrompt += characterPromptSection(characters)
+	if len(characters) > 0 {
+		userPrompt += fmt.Sprintf(" The cat is %s.", characters[0].Name)
+	}
+
+	completionReq := CompletionRequest{
+		System:      systemPrompt,
+		User:        userPrompt,
+		MaxTokens:   contentPackageTokens,
 		Temperature: 0.9,
-	})
+		Seed:        draw.seed,
+		AccountID:   req.AccountID,
+	}
+	pkg, _, err := pg.requestContentPackage(ctx, completionReq)
 
 	if err != nil {
-		fmt.Printf("Failed to generate prompt: %v\n", err)
-		// Fallback prompt
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if strict || (errors.Is(err, ErrBudgetExceeded) && budget.Refuses(req.AccountID)) {
+			return nil, fmt.Errorf("failed to generate prompt: %w", err)
+		}
+		fmt.Printf("Failed to generate prompt, using fallback: %v\n", err)
 		return &VideoPrompt{
-			ID:        uuid.New().String(),
-			Text:      fmt.Sprintf("A cat %s while contemplating %s, occasionally making direct eye contact with the camera to break the fourth wall.", situation, theme),
-			Theme:     theme,
-			CreatedAt: time.Now(),
+			ID:             uuid.New().String(),
+			Text:           fmt.Sprintf("A cat %s while contemplating %s, occasionally making direct eye contact with the camera to break the fourth wall.", situation, theme),
+			Theme:          theme,
+			Situation:      situation,
+			Source:         PromptSourceFallback,
+			FallbackReason: err.Error(),
+			AccountID:      req.AccountID,
+			Characters:     characterIDs(characters),
+			Trend:          trend,
+			Seed:           draw.seed,
+			CreatedAt:      time.Now(),
 		}, nil
 	}
 
-	promptText := resp.Choices[0].Message.Content
-	if promptText == "" {
-		promptText = "A cat stares judgmentally at the camera while questioning the meaning of existence."
-	}
-
 	return &VideoPrompt{
-		ID:        uuid.New().String(),
-		Text:      promptText,
-		Theme:     theme,
-		CreatedAt: time.Now(),
+		ID:          uuid.New().String(),
+		Text:        pkg.VideoPrompt,
+		Theme:       theme,
+		Situation:   situation,
+		Model:       pg.model.Name(),
+		Source:      PromptSourceLLM,
+		AccountID:   req.AccountID,
+		Characters:  characterIDs(characters),
+		Trend:       trend,
+		Seed:        draw.seed,
+		ModelParams: modelParamsFor(completionReq),
+		Content:     pkg,
+		CreatedAt:   time.Now(),
 	}, nil
 }
 
-func (pg *PromptGenerator) GenerateBatch(ctx context.Context, count int) ([]*VideoPrompt, error) {
-	prompts := make([]*VideoPrompt, 0, count)
-	
-	for i := 0; i < count; i++ {
-		prompt, err := pg.GeneratePrompt(ctx)
+// SetSeed restarts the generator's random sequence. Prompts draw their own
+// seeds from it in request order, so the same seed, inputs and batch size
+// reproduce the same themes, situations, trends and characters.
+func (pg *PromptGenerator) SetSeed(seed int64) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.seed = seed
+	pg.rng = rand.New(rand.NewSource(seed))
+}
+
+func (pg *PromptGenerator) Seed() int64 {
+	pg.mu.RLock()
+	defer pg.mu.RUnlock()
+	return pg.seed
+}
+
+func (pg *PromptGenerator) nextSeed() int64 {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	return pg.rng.Int63()
+}
+
+// SetStrict disables the template fallback: model failures are returned as
+// errors (matching ErrRateLimited, ErrAuth, ErrQuotaExceeded or
+// ErrContentFiltered where possible) instead of being papered over.
+func (pg *PromptGenerator) SetStrict(strict bool) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.strict = strict
+}
+
+// SetBudget records the token spend of every completion and stops
+// requesting completions for accounts whose group is over budget. Their
+// prompts fall back to the template unless strict mode or the group refuses.
+func (pg *PromptGenerator) SetBudget(budget *Budget) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.budget = budget
+}
+
+func (pg *PromptGenerator) SetBandit(bandit *PromptBandit) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.bandit = bandit
+}
+
+func (pg *PromptGenerator) SetNoveltyChecker(novelty *NoveltyChecker) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.novelty = novelty
+}
+
+func (pg *PromptGenerator) SetCharacters(characters *CharacterRegistry) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.characters = characters
+}
+
+func (pg *PromptGenerator) resolveCharacters(req PromptRequest, rng *rand.Rand) ([]*Character, error) {
+	pg.mu.RLock()
+	registry := pg.characters
+	pg.mu.RUnlock()
+
+	if registry == nil {
+		if len(req.CharacterIDs) > 0 {
+			return nil, fmt.Errorf("characters requested but no character bible is loaded")
+		}
+		return nil, nil
+	}
+	return registry.resolve(req, rng)
+}
+
+// selectPrompt makes the random choices for one generation attempt and
+// records them on the draw.
+func (pg *PromptGenerator) selectPrompt(req PromptRequest, draw *promptDraw) (PromptSelection, *TrendTheme, []*Character, error) {
+	theme, situation, trend := pg.pickThemeAndSituation(draw.rng)
+
+	characters, err := pg.resolveCharacters(req, draw.rng)
+	if err != nil {
+		return PromptSelection{}, nil, nil, err
+	}
+
+	selection := PromptSelection{
+		Theme:      theme,
+		Situation:  situation,
+		Trend:      trend != nil,
+		Characters: characterIDs(characters),
+	}
+	draw.selections = append(draw.selections, selection)
+	return selection, trend, characters, nil
+}
+
+// pickThemeAndSituation returns a catalog or bandit choice. When a trend
+// pool is set, a share of themes come from current trends instead and the
+// trend is returned so it can be recorded on the prompt.
+func (pg *PromptGenerator) pickThemeAndSituation(rng *rand.Rand) (string, string, *TrendTheme) {
+	pg.mu.RLock()
+	catalog, bandit, trends := pg.catalog, pg.bandit, pg.trends
+	pg.mu.RUnlock()
+
+	var trend *TrendTheme
+	if trends != nil {
+		trend = trends.pick(rng)
+	}
+
+	var theme, situation string
+	if bandit == nil {
+		theme, situation = catalog.PickTheme(rng).Text, catalog.PickSituation(rng).Text
+	} else {
+		theme, situation = bandit.ChooseTheme(catalog.Themes, rng).Text, bandit.ChooseSituation(catalog.Situations, rng).Text
+	}
+
+	if trend != nil {
+		theme = trend.Theme
+	}
+	return theme, situation, trend
+}
+
+func (pg *PromptGenerator) recordPrompt(prompt *VideoPrompt) *VideoPrompt {
+	pg.mu.RLock()
+	bandit := pg.bandit
+	pg.mu.RUnlock()
+
+	// Trend themes expire, so keeping bandit arms for them would only grow
+	// the state file.
+	if bandit != nil && prompt.Trend == nil {
+		if err := bandit.RecordPrompt(prompt); err != nil {
+			fmt.Printf("Failed to record prompt for bandit: %v\n", err)
+		}
+	}
+	return prompt
+}
+
+func (pg *PromptGenerator) GenerateBatch(ctx context.Context, count int) ([]PromptResult, error) {
+	return pg.GenerateBatchFor(ctx, count, PromptRequest{})
+}
+
+// GenerateBatchFor fans prompt generation out over a bounded worker pool.
+// Every requested prompt gets a result in order; cancelling ctx stops
+// outstanding work and marks unfinished items with the context error.
+// Seeds are drawn up front so item i gets the same seed however the
+// workers are scheduled.
+func (pg *PromptGenerator) GenerateBatchFor(ctx context.Context, count int, req PromptRequest) ([]PromptResult, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("prompt batch size must not be negative, got %d", count)
+	}
+	if count == 0 {
+		return []PromptResult{}, nil
+	}
+
+	pg.mu.RLock()
+	workers := pg.batch.Workers
+	pg.mu.RUnlock()
+	if workers > count {
+		workers = count
+	}
+
+	results := make([]PromptResult, count)
+	seeds := make([]int64, count)
+	for i := range results {
+		results[i].Index = i
+		seeds[i] = pg.nextSeed()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				prompt, err := pg.generatePrompt(ctx, req, seeds[i])
+				if err != nil {
+					fmt.Printf("Failed to generate prompt %d: %v\n", i+1, err)
+				}
+				results[i].Prompt = prompt
+				results[i].Err = err
+			}
+		}()
+	}
+
+	queued := 0
+feed:
+	for ; queued < count; queued++ {
+		select {
+		case jobs <- queued:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := queued; i < count; i++ {
+		results[i].Err = ctx.Err()
+	}
+
+	return results, ctx.Err()
+}
+
+func SuccessfulPrompts(results []PromptResult) []*VideoPrompt {
+	prompts := make([]*VideoPrompt, 0, len(results))
+	for _, result := range results {
+		if result.Err == nil && result.Prompt != nil {
+			prompts = append(prompts, result.Prompt)
+		}
+	}
+	return prompts
+}
+
+// complete sends a request through the shared rate limiter. A 429 pauses
+// the limiter for every worker for the server's Retry-After before retrying.
+func (pg *PromptGenerator) complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	pg.mu.RLock()
+	limiter, maxRetries, budget := pg.limiter, pg.batch.MaxRetries, pg.budget
+	pg.mu.RUnlock()
+
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		reservation, err := pg.reserveTokens(budget, req)
 		if err != nil {
-			fmt.Printf("Failed to generate prompt %d: %v\n", i+1, err)
-			continue
+			return nil, err
+		}
+
+		resp, err := pg.model.Complete(ctx, req)
+		if err == nil {
+			pg.commitTokens(budget, reservation, resp)
+		}
+		reservation.Release()
+		if err == nil || !errors.Is(err, ErrRateLimited) || attempt >= maxRetries {
+			return resp, err
+		}
+
+		var backoff time.Duration
+		var rateLimitErr *RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			backoff = rateLimitErr.RetryAfter
+		}
+		if backoff <= 0 {
+			backoff = time.Duration(1<<attempt) * time.Second
 		}
-		prompts = append(prompts, prompt)
+		fmt.Printf("Prompt model rate limited, pausing %s before retry %d/%d\n", backoff, attempt+1, maxRetries)
+		limiter.PauseFor(backoff)
 	}
+}
+
+// reserveTokens holds what a request can cost at most: its prompt, at
+// roughly four characters a token, plus MaxTokens of output.
+func (pg *PromptGenerator) reserveTokens(budget *Budget, req CompletionRequest) (*BudgetReservation, error) {
+	if budget == nil {
+		return nil, nil
+	}
+	promptChars := len(req.System) + len(req.User)
+	if req.Schema != nil {
+		promptChars += len(req.Schema.Schema)
+	}
+	estimate := budget.TokenCost(pg.model.Name(), promptChars/4, req.MaxTokens)
+	return budget.Reserve(req.AccountID, estimate)
+}
 
-	return prompts, nil
-}
\ No newline at end of file
+func (pg *PromptGenerator) commitTokens(budget *Budget, reservation *BudgetReservation, resp *Completion) {
+	if budget == nil {
+		return
+	}
+	if err := reservation.Commit(SpendEntry{
+		Kind:             SpendTokens,
+		Item:             pg.model.Name(),
+		PromptTokens:     resp.PromptTokens,
+		CompletionTokens: resp.CompletionTokens,
+		Cost:             budget.TokenCost(pg.model.Name(), resp.PromptTokens, resp.CompletionTokens),
+	}); err != nil {
+		fmt.Printf("Failed to record token spend: %v\n", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type PromptRecord struct {
+	ID         string    `json:"id"`
+	Text       string    `json:"text"`
+	Theme      string    `json:"theme"`
+	Situation  string    `json:"situation,omitempty"`
+	Signature  []uint32  `json:"signature,omitempty"`
+	Embedding  []float32 `json:"embedding,omitempty"`
+	ParentIDs  []string  `json:"parent_ids,omitempty"`
+	Generation int       `json:"generation,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PromptHistory is an append-only JSON Lines log of every accepted prompt.
+type PromptHistory struct {
+	path    string
+	records []PromptRecord
+	index   map[string]int
+	mu      sync.RWMutex
+}
+
+func LoadPromptHistory(path string) (*PromptHistory, error) {
+	h := &PromptHistory{
+		path:  path,
+		index: make(map[string]int),
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open prompt history: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record PromptRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode prompt history line %d: %w", line, err)
+		}
+		h.index[record.ID] = len(h.records)
+		h.records = append(h.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read prompt history: %w", err)
+	}
+
+	return h, nil
+}
+
+func (h *PromptHistory) Add(record PromptRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode prompt record: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if dir := filepath.Dir(h.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create prompt history directory: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open prompt history: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to append prompt history: %w", err)
+	}
+
+	h.index[record.ID] = len(h.records)
+	h.records = append(h.records, record)
+	return nil
+}
+
+func (h *PromptHistory) Get(id string) (PromptRecord, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	i, ok := h.index[id]
+	if !ok {
+		return PromptRecord{}, false
+	}
+	return h.records[i], true
+}
+
+func (h *PromptHistory) Since(cutoff time.Time) []PromptRecord {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	records := make([]PromptRecord, 0)
+	for _, record := range h.records {
+		if !record.CreatedAt.Before(cutoff) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
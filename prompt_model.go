@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	openai "github.com/sashabaranov/go-openai"
+	"google.golang.org/api/option"
+)
+
+type PromptModel interface {
+	Name() string
+	Complete(ctx context.Context, req CompletionRequest) (*Completion, error)
+}
+
+type CompletionRequest struct {
+	System      string
+	User        string
+	MaxTokens   int
+	Temperature float32
+	// Seed asks the model for repeatable sampling where the backend
+	// supports it; zero leaves sampling unseeded.
+	Seed int64
+	// Schema requests a JSON reply matching the schema when set.
+	Schema *JSONSchema
+	// AccountID attributes the request's spend to an account's budget. It
+	// is not sent to the model.
+	AccountID string
+}
+
+type JSONSchema struct {
+	Name   string
+	Schema json.RawMessage
+}
+
+type Completion struct {
+	Text             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+type PromptModelProvider string
+
+const (
+	PromptModelOpenAI PromptModelProvider = "openai"
+	PromptModelGemini PromptModelProvider = "gemini"
+	PromptModelLocal  PromptModelProvider = "local"
+)
+
+// NewPromptModelFromEnv picks the LLM backend from PROMPT_MODEL_PROVIDER,
+// letting PROMPT_MODEL override the provider's default model name.
+func NewPromptModelFromEnv(ctx context.Context) (PromptModel, error) {
+	provider := PromptModelProvider(getEnvWithDefault("PROMPT_MODEL_PROVIDER", string(PromptModelOpenAI)))
+	modelName := os.Getenv("PROMPT_MODEL")
+
+	switch provider {
+	case PromptModelOpenAI:
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is required for openai prompt model")
+		}
+		return NewOpenAIPromptModel(apiKey, modelName), nil
+
+	case PromptModelGemini:
+		apiKey := os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is required for gemini prompt model")
+		}
+		return NewGeminiPromptModel(ctx, apiKey, modelName)
+
+	case PromptModelLocal:
+		return NewLocalPromptModel(getEnvWithDefault("LOCAL_LLM_URL", "http://localhost:11434/v1"), os.Getenv("LOCAL_LLM_API_KEY"), modelName)
+
+	default:
+		return nil, fmt.Errorf("unknown prompt model provider: %s", provider)
+	}
+}
+
+type openAIPromptModel struct {
+	client *openai.Client
+	name   string
+	model  string
+}
+
+func NewOpenAIPromptModel(apiKey, model string) PromptModel {
+	if model == "" {
+		model = openai.GPT4oMini
+	}
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = &retryAfterDoer{client: &http.Client{Timeout: 60 * time.Second}}
+
+	return &openAIPromptModel{
+		client: openai.NewClientWithConfig(config),
+		name:   string(PromptModelOpenAI),
+		model:  model,
+	}
+}
+
+// NewLocalPromptModel talks to any server exposing the OpenAI chat
+// completions API (Ollama, llama.cpp, vLLM, LM Studio, ...).
+func NewLocalPromptModel(baseURL, apiKey, model string) (PromptModel, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("LOCAL_LLM_URL is required for local prompt model")
+	}
+	if model == "" {
+		model = "llama3.1"
+	}
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = strings.TrimSuffix(baseURL, "/")
+	config.HTTPClient = &retryAfterDoer{client: &http.Client{Timeout: 120 * time.Second}}
+
+	return &openAIPromptModel{
+		client: openai.NewClientWithConfig(config),
+		name:   string(PromptModelLocal),
+		model:  model,
+	}, nil
+}
+
+func (m *openAIPromptModel) Name() string {
+	return m.name + "/" + m.model
+}
+
+func (m *openAIPromptModel) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	chatReq := openai.ChatCompletionRequest{
+		Model: m.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: req.System},
+			{Role: openai.ChatMessageRoleUser, Content: req.User},
+		},
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+	if req.Seed != 0 {
+		seed := int(req.Seed)
+		chatReq.Seed = &seed
+	}
+	if req.Schema != nil {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   req.Schema.Name,
+				Schema: req.Schema.Schema,
+				Strict: true,
+			},
+		}
+	}
+
+	resp, err := m.client.CreateChatCompletion(ctx, chatReq)
+	if err != nil {
+		return nil, classifyModelError(fmt.Errorf("%s completion failed: %w", m.name, err))
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("%s returned no choices", m.name)
+	}
+	if resp.Choices[0].FinishReason == openai.FinishReasonContentFilter {
+		return nil, fmt.Errorf("%w: %s stopped the completion", ErrContentFiltered, m.name)
+	}
+	if refusal := resp.Choices[0].Message.Refusal; refusal != "" {
+		return nil, fmt.Errorf("%w: %s refused: %s", ErrContentFiltered, m.name, refusal)
+	}
+
+	return &Completion{
+		Text:             resp.Choices[0].Message.Content,
+		Model:            m.model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
+
+func (m *openAIPromptModel) Embed(ctx context.Context, text string) ([]float32, error) {
+	resp, err := m.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: []string{text},
+		Model: openai.SmallEmbedding3,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s embedding failed: %w", m.name, err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("%s returned no embeddings", m.name)
+	}
+	return resp.Data[0].Embedding, nil
+}
+
+type geminiPromptModel struct {
+	client *genai.Client
+	model  string
+}
+
+func NewGeminiPromptModel(ctx context.Context, apiKey, model string) (PromptModel, error) {
+	if model == "" {
+		model = "gemini-1.5-flash"
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+
+	return &geminiPromptModel{
+		client: client,
+		model:  model,
+	}, nil
+}
+
+func (m *geminiPromptModel) Name() string {
+	return string(PromptModelGemini) + "/" + m.model
+}
+
+func (m *geminiPromptModel) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	model := m.client.GenerativeModel(m.model)
+	system := req.System
+	if req.Schema != nil {
+		model.ResponseMIMEType = "application/json"
+		system += "\n\nReply with a single JSON object matching this JSON schema:\n" + string(req.Schema.Schema)
+	}
+	model.SystemInstruction = genai.NewUserContent(genai.Text(system))
+	model.SetTemperature(req.Temperature)
+	if req.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(req.MaxTokens))
+	}
+
+	resp, err := model.GenerateContent(ctx, genai.Text(req.User))
+	if err != nil {
+		return nil, classifyModelError(fmt.Errorf("gemini completion failed: %w", err))
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("gemini returned no candidates")
+	}
+
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if t, ok := part.(genai.Text); ok {
+			text.WriteString(string(t))
+		}
+	}
+
+	completion := &Completion{
+		Text:  text.String(),
+		Model: m.model,
+	}
+	if resp.UsageMetadata != nil {
+		completion.PromptTokens = int(resp.UsageMetadata.PromptTokenCount)
+		completion.CompletionTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+	}
+
+	return completion, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a small token-bucket limiter that can also be paused,
+// which is how a server's Retry-After is honoured by every caller at once.
+type tokenBucket struct {
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	mu          sync.Mutex
+}
+
+func newTokenBucket(ratePerSecond float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   ratePerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (tb *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		delay := tb.reserve()
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns zero, or returns how long to wait
+// before trying again.
+func (tb *tokenBucket) reserve() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(tb.pausedUntil) {
+		return tb.pausedUntil.Sub(now)
+	}
+
+	if tb.rate <= 0 {
+		return 0
+	}
+
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+func (tb *tokenBucket) PauseFor(d time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(tb.pausedUntil) {
+		tb.pausedUntil = until
+	}
+	tb.tokens = 0
+}
+
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited (retry after %s): %s", e.RetryAfter, e.Message)
+	}
+	return fmt.Sprintf("rate limited: %s", e.Message)
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// retryAfterDoer turns HTTP 429 responses into a RateLimitError carrying
+// the Retry-After delay, which go-openai would otherwise discard.
+// Exhausted quota is also reported as 429 by OpenAI but retrying cannot
+// fix it, so those responses are passed through untouched.
+type retryAfterDoer struct {
+	client *http.Client
+}
+
+func (d *retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if strings.Contains(string(body), "insufficient_quota") {
+		resp.Body = io.NopCloser(strings.NewReader(string(body)))
+		return resp, nil
+	}
+
+	return nil, &RateLimitError{
+		RetryAfter: parseRetryAfter(resp.Header),
+		Message:    strings.TrimSpace(string(body)),
+	}
+}
+
+func parseRetryAfter(header http.Header) time.Duration {
+	if value := header.Get("retry-after-ms"); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var ErrNotReelsCompatible = errors.New("video does not meet the Instagram Reels spec")
+
+// Instagram's published Reels limits for Graph API uploads.
+const (
+	reelsMinDuration = 3.0
+	reelsMaxDuration = 15 * 60.0
+	reelsMaxSize     = 300 << 20
+	reelsMaxWidth    = 1920
+	reelsMinFPS      = 23.0
+	reelsMaxFPS      = 60.0
+	reelsMaxAudioHz  = 48000
+)
+
+var (
+	reelsVideoCodecs = map[string]bool{"avc1": true, "avc3": true, "hvc1": true, "hev1": true}
+	reelsAudioCodecs = map[string]bool{"mp4a": true}
+)
+
+// ReelsCheck lists what keeps a video from being posted as a Reel, and
+// what Instagram accepts but handles worse, such as letterboxing anything
+// that is not 9:16.
+type ReelsCheck struct {
+	Problems []string
+	Warnings []string
+}
+
+func (c ReelsCheck) Err() error {
+	if len(c.Problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotReelsCompatible, strings.Join(c.Problems, "; "))
+}
+
+func formatAudio(metadata *VideoMetadata) string {
+	if !metadata.HasAudio {
+		return "none"
+	}
+	return fmt.Sprintf("%s %d Hz, %d ch", metadata.AudioCodec, metadata.SampleRate, metadata.Channels)
+}
+
+func CheckReels(metadata *VideoMetadata) ReelsCheck {
+	var check ReelsCheck
+	problem := func(format string, args ...interface{}) {
+		check.Problems = append(check.Problems, fmt.Sprintf(format, args...))
+	}
+	warning := func(format string, args ...interface{}) {
+		check.Warnings = append(check.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	if metadata.DurationSeconds < reelsMinDuration || metadata.DurationSeconds > reelsMaxDuration {
+		problem("duration %.1fs is outside %.0fs to %.0fs", metadata.DurationSeconds, reelsMinDuration, reelsMaxDuration)
+	}
+	if metadata.Size > reelsMaxSize {
+		problem("file is %d MB, more than %d MB", metadata.Size>>20, reelsMaxSize>>20)
+	}
+	if !reelsVideoCodecs[metadata.VideoCodec] {
+		problem("video codec %q is not H.264 or HEVC", metadata.VideoCodec)
+	}
+	if metadata.Width > reelsMaxWidth {
+		problem("width %d is more than %d pixels", metadata.Width, reelsMaxWidth)
+	}
+	if metadata.FrameRate < reelsMinFPS || metadata.FrameRate > reelsMaxFPS {
+		problem("frame rate %.2f fps is outside %.0f to %.0f", metadata.FrameRate, reelsMinFPS, reelsMaxFPS)
+	}
+	if metadata.HasAudio {
+		if !reelsAudioCodecs[metadata.AudioCodec] {
+			problem("audio codec %q is not AAC", metadata.AudioCodec)
+		}
+		if metadata.SampleRate > reelsMaxAudioHz {
+			problem("audio sample rate %d Hz is more than %d Hz", metadata.SampleRate, reelsMaxAudioHz)
+		}
+		if metadata.Channels > 2 {
+			problem("audio has %d channels, at most 2 are allowed", metadata.Channels)
+		}
+	}
+
+	if metadata.Width > 0 && metadata.Height > 0 {
+		if ratio := float64(metadata.Width) / float64(metadata.Height); math.Abs(ratio-9.0/16.0) > 0.01 {
+			warning("aspect ratio %s is not 9:16 and will be letterboxed", metadata.AspectRatio)
+		}
+	}
+	if !metadata.FastStart {
+		warning("moov box is after the media data")
+	}
+	if metadata.EditList {
+		warning("video has an edit list")
+	}
+	return check
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReels(t *testing.T) {
+	valid := func() *VideoMetadata {
+		return &VideoMetadata{
+			DurationSeconds: 8,
+			Width:           1080,
+			Height:          1920,
+			AspectRatio:     "9:16",
+			VideoCodec:      "avc1",
+			FrameRate:       30,
+			HasAudio:        true,
+			AudioCodec:      "mp4a",
+			SampleRate:      48000,
+			Channels:        2,
+			Size:            12 << 20,
+			Brand:           "isom",
+			FastStart:       true,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		change       func(m *VideoMetadata)
+		wantProblems int
+		wantWarnings int
+	}{
+		{name: "valid", change: func(m *VideoMetadata) {}},
+		{name: "no audio", change: func(m *VideoMetadata) { m.HasAudio, m.AudioCodec, m.SampleRate, m.Channels = false, "", 0, 0 }},
+		{name: "too short", change: func(m *VideoMetadata) { m.DurationSeconds = 2.9 }, wantProblems: 1},
+		{name: "too long", change: func(m *VideoMetadata) { m.DurationSeconds = 15*60 + 1 }, wantProblems: 1},
+		{name: "too large", change: func(m *VideoMetadata) { m.Size = 301 << 20 }, wantProblems: 1},
+		{name: "HEVC", change: func(m *VideoMetadata) { m.VideoCodec = "hvc1" }},
+		{name: "VP9", change: func(m *VideoMetadata) { m.VideoCodec = "vp09" }, wantProblems: 1},
+		{name: "too wide", change: func(m *VideoMetadata) { m.Width, m.Height, m.AspectRatio = 2160, 3840, "9:16" }, wantProblems: 1},
+		{name: "too slow", change: func(m *VideoMetadata) { m.FrameRate = 15 }, wantProblems: 1},
+		{name: "too fast", change: func(m *VideoMetadata) { m.FrameRate = 120 }, wantProblems: 1},
+		{name: "Opus audio", change: func(m *VideoMetadata) { m.AudioCodec = "Opus" }, wantProblems: 1},
+		{name: "96 kHz audio", change: func(m *VideoMetadata) { m.SampleRate = 96000 }, wantProblems: 1},
+		{name: "surround audio", change: func(m *VideoMetadata) { m.Channels = 6 }, wantProblems: 1},
+		{name: "landscape", change: func(m *VideoMetadata) { m.Width, m.Height, m.AspectRatio = 1920, 1080, "16:9" }, wantWarnings: 1},
+		{name: "moov at the end", change: func(m *VideoMetadata) { m.FastStart = false }, wantWarnings: 1},
+		{name: "edit list", change: func(m *VideoMetadata) { m.EditList = true }, wantWarnings: 1},
+		{name: "empty metadata", change: func(m *VideoMetadata) { *m = VideoMetadata{} }, wantProblems: 3, wantWarnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := valid()
+			tt.change(metadata)
+			check := CheckReels(metadata)
+			if len(check.Problems) != tt.wantProblems {
+				t.Errorf("Problems = %q, want %d", check.Problems, tt.wantProblems)
+			}
+			if len(check.Warnings) != tt.wantWarnings {
+				t.Errorf("Warnings = %q, want %d", check.Warnings, tt.wantWarnings)
+			}
+			if err := check.Err(); (err != nil) != (tt.wantProblems > 0) {
+				t.Errorf("Err() = %v", err)
+			} else if err != nil && !errors.Is(err, ErrNotReelsCompatible) {
+				t.Errorf("Err() = %v, want ErrNotReelsCompatible", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+func replayRun(runID string) {
+	dir := os.Getenv("RUN_LOG_DIR")
+	if dir == "" {
+		log.Fatalf("RUN_LOG_DIR must point at the run logs to replay")
+	}
+
+	run, err := LoadRunLog(dir, runID)
+	if err != nil {
+		log.Fatalf("Failed to load run: %v", err)
+	}
+	fmt.Printf("🔁 Replaying run %s (seed %d, started %s, %d prompts)\n", run.ID, run.Seed, run.StartedAt.Format("2006-01-02 15:04:05"), len(run.Prompts))
+
+	results, err := run.Replay()
+	if err != nil {
+		log.Fatalf("Failed to replay run: %v", err)
+	}
+
+	diverged := 0
+	for i, result := range results {
+		status := "✅"
+		if !result.Matches() {
+			status = "❌"
+			diverged++
+		}
+		fmt.Printf("%s %d. %s (seed %d)\n", status, i+1, result.PromptID, result.Seed)
+		for attempt, selection := range result.Replayed {
+			fmt.Printf("   attempt %d: %s\n", attempt+1, describeSelection(selection))
+			if attempt < len(result.Recorded) && !result.Matches() {
+				fmt.Printf("   recorded:  %s\n", describeSelection(result.Recorded[attempt]))
+			}
+		}
+	}
+
+	if diverged > 0 {
+		fmt.Printf("%d of %d prompts diverged from the recorded selection path\n", diverged, len(results))
+		os.Exit(1)
+	}
+	fmt.Printf("All %d prompts reproduced the recorded selection path\n", len(results))
+}
+
+func describeSelection(selection PromptSelection) string {
+	description := fmt.Sprintf("theme %q, the cat %s", selection.Theme, selection.Situation)
+	if selection.Trend {
+		description += " [trend]"
+	}
+	if len(selection.Characters) > 0 {
+		description += " with " + strings.Join(selection.Characters, ", ")
+	}
+	if len(selection.ParentIDs) > 0 {
+		description += " bred from " + strings.Join(selection.ParentIDs, " x ")
+	}
+	return description
+}
+
+func init() {
+	// go run ... replay <run-id> re-draws a logged run's selections
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if len(os.Args) < 3 {
+			log.Fatalf("usage: replay <run-id>")
+		}
+		replayRun(os.Args[2])
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/replicate/replicate-go"
+)
+
+// Replicate signs each webhook with the time it was sent. Older deliveries
+// are rejected so a captured request cannot be replayed later.
+const replicateWebhookTolerance = 5 * time.Minute
+
+// replicateWebhookMaxBody bounds a webhook body; a prediction is a few KB.
+const replicateWebhookMaxBody = 1 << 20
+
+type ReplicateWebhookConfig struct {
+	// URL is where Replicate can reach this process, e.g. a tunnel or load
+	// balancer in front of Addr. Its path is the path the server handles.
+	URL  string
+	Addr string
+	// Secret is the webhook signing secret, "whsec_..."; the account's
+	// default secret is fetched from Replicate when it is empty.
+	Secret string
+	// PollInterval is how often predictions are still polled in case a
+	// webhook is lost.
+	PollInterval time.Duration
+}
+
+// NewReplicateWebhookConfigFromEnv reads REPLICATE_WEBHOOK_URL,
+// REPLICATE_WEBHOOK_ADDR, REPLICATE_WEBHOOK_SECRET and
+// REPLICATE_POLL_INTERVAL_SECONDS. It returns nil when no webhook URL is
+// set, in which case predictions are polled every second as before.
+func NewReplicateWebhookConfigFromEnv() (*ReplicateWebhookConfig, error) {
+	webhookURL := os.Getenv("REPLICATE_WEBHOOK_URL")
+	if webhookURL == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("REPLICATE_WEBHOOK_URL must be an http(s) URL, got %q", webhookURL)
+	}
+
+	config := &ReplicateWebhookConfig{
+		URL:          webhookURL,
+		Addr:         getEnvWithDefault("REPLICATE_WEBHOOK_ADDR", ":8080"),
+		Secret:       os.Getenv("REPLICATE_WEBHOOK_SECRET"),
+		PollInterval: 2 * time.Minute,
+	}
+
+	if value := os.Getenv("REPLICATE_POLL_INTERVAL_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("REPLICATE_POLL_INTERVAL_SECONDS must be a positive integer, got %q", value)
+		}
+		config.PollInterval = time.Duration(seconds) * time.Second
+	}
+
+	return config, nil
+}
+
+// ReplicateWebhookServer receives Replicate's completion webhooks, verifies
+// their signatures and hands each finished prediction to whoever is
+// waiting for it.
+type ReplicateWebhookServer struct {
+	config  ReplicateWebhookConfig
+	path    string
+	secret  replicate.WebhookSigningSecret
+	server  *http.Server
+	waiters map[string][]chan *replicate.Prediction
+	mu      sync.Mutex
+}
+
+func NewReplicateWebhookServer(ctx context.Context, config ReplicateWebhookConfig) (*ReplicateWebhookServer, error) {
+	parsed, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Replicate webhook URL: %w", err)
+	}
+
+	secret := replicate.WebhookSigningSecret{Key: config.Secret}
+	if secret.Key == "" {
+		client, err := replicate.NewClient(replicate.WithToken(os.Getenv("REPLICATE_API_KEY")))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Replicate client: %w", err)
+		}
+		fetched, err := client.GetDefaultWebhookSecret(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Replicate webhook secret: %w", err)
+		}
+		secret = *fetched
+	}
+
+	s := &ReplicateWebhookServer{
+		config:  config,
+		path:    parsed.Path,
+		secret:  secret,
+		waiters: make(map[string][]chan *replicate.Prediction),
+	}
+	if s.path == "" {
+		s.path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(s.path, s)
+	s.server = &http.Server{
+		Addr:              config.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+func NewReplicateWebhookServerFromEnv(ctx context.Context) (*ReplicateWebhookServer, error) {
+	config, err := NewReplicateWebhookConfigFromEnv()
+	if err != nil || config == nil {
+		return nil, err
+	}
+	return NewReplicateWebhookServer(ctx, *config)
+}
+
+// Start listens on the configured address and serves webhooks in the
+// background until Shutdown.
+func (s *ReplicateWebhookServer) Start() error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for Replicate webhooks: %w", err)
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Replicate webhook server stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+func (s *ReplicateWebhookServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Webhook is what new predictions are created with.
+func (s *ReplicateWebhookServer) Webhook() *replicate.Webhook {
+	return &replicate.Webhook{
+		URL:    s.config.URL,
+		Events: []replicate.WebhookEventType{replicate.WebhookEventCompleted},
+	}
+}
+
+func (s *ReplicateWebhookServer) PollInterval() time.Duration {
+	return s.config.PollInterval
+}
+
+// Subscribe returns a channel that receives the prediction once a webhook
+// reports it finished. Call the returned function when done waiting.
+func (s *ReplicateWebhookServer) Subscribe(predictionID string) (<-chan *replicate.Prediction, func()) {
+	done := make(chan *replicate.Prediction, 1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.waiters[predictionID] = append(s.waiters[predictionID], done)
+
+	return done, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		waiters := s.waiters[predictionID]
+		for i, waiter := range waiters {
+			if waiter == done {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(s.waiters, predictionID)
+		} else {
+			s.waiters[predictionID] = waiters
+		}
+	}
+}
+
+func (s *ReplicateWebhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, replicateWebhookMaxBody)
+
+	if err := s.verify(r); err != nil {
+		fmt.Printf("Rejected Replicate webhook: %v\n", err)
+		http.Error(w, "invalid webhook", http.StatusUnauthorized)
+		return
+	}
+
+	var prediction replicate.Prediction
+	if err := json.NewDecoder(r.Body).Decode(&prediction); err != nil || prediction.ID == "" {
+		http.Error(w, "invalid prediction", http.StatusBadRequest)
+		return
+	}
+
+	if prediction.Status.Terminated() {
+		s.complete(&prediction)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *ReplicateWebhookServer) verify(r *http.Request) error {
+	sent, err := strconv.ParseInt(r.Header.Get("webhook-timestamp"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook-timestamp %q", r.Header.Get("webhook-timestamp"))
+	}
+	if age := time.Since(time.Unix(sent, 0)); age > replicateWebhookTolerance || age < -replicateWebhookTolerance {
+		return fmt.Errorf("webhook sent %s ago is outside the %s tolerance", age.Round(time.Second), replicateWebhookTolerance)
+	}
+
+	valid, err := replicate.ValidateWebhookRequest(r, s.secret)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("signature does not match")
+	}
+	return nil
+}
+
+// complete delivers a finished prediction. Predictions nobody waits for,
+// e.g. from a previous run, are picked up by polling when resumed.
+func (s *ReplicateWebhookServer) complete(prediction *replicate.Prediction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, waiter := range s.waiters[prediction.ID] {
+		select {
+		case waiter <- prediction:
+		default:
+		}
+	}
+}
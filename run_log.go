@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RunConfig struct {
+	Seed   int64
+	LogDir string
+}
+
+// RunLog records what a generation run drew so the run can be replayed:
+// the inputs every pick depends on at the start of the run, and each
+// prompt's seed and per-attempt selections.
+type RunLog struct {
+	ID        string      `json:"id"`
+	Seed      int64       `json:"seed"`
+	StartedAt time.Time   `json:"started_at"`
+	Snapshot  RunSnapshot `json:"snapshot"`
+	Prompts   []RunPrompt `json:"prompts"`
+	path      string
+	mu        sync.Mutex
+}
+
+type RunSnapshot struct {
+	Catalog    *PromptCatalog     `json:"catalog"`
+	Bandit     *BanditSnapshot    `json:"bandit,omitempty"`
+	Trends     *TrendSnapshot     `json:"trends,omitempty"`
+	Characters *CharacterSnapshot `json:"characters,omitempty"`
+}
+
+type BanditSnapshot struct {
+	Exploration float64             `json:"exploration"`
+	Themes      map[string]ArmStats `json:"themes"`
+	Situations  map[string]ArmStats `json:"situations"`
+}
+
+type TrendSnapshot struct {
+	Share  float64      `json:"share"`
+	Themes []TrendTheme `json:"themes"`
+}
+
+type CharacterSnapshot struct {
+	Characters []*Character        `json:"characters"`
+	Casts      map[string][]string `json:"casts"`
+}
+
+type RunPrompt struct {
+	PromptID     string            `json:"prompt_id"`
+	Seed         int64             `json:"seed"`
+	AccountID    string            `json:"account_id,omitempty"`
+	CharacterIDs []string          `json:"character_ids,omitempty"`
+	Selections   []PromptSelection `json:"selections"`
+	Source       PromptSource      `json:"source"`
+	Model        string            `json:"model,omitempty"`
+	ModelParams  *ModelParams      `json:"model_params,omitempty"`
+	Evolution    *RunEvolution     `json:"evolution,omitempty"`
+}
+
+// RunEvolution is the parent pool an evolved prompt drew from, best first.
+type RunEvolution struct {
+	CrossoverRate float64           `json:"crossover_rate"`
+	Parents       []EvolutionParent `json:"parents"`
+}
+
+type EvolutionParent struct {
+	ID        string `json:"id"`
+	Theme     string `json:"theme"`
+	Situation string `json:"situation"`
+}
+
+// PromptSelection is what one generation attempt picked before asking the
+// model. Novelty rejections make a prompt take several attempts.
+type PromptSelection struct {
+	Theme      string   `json:"theme"`
+	Situation  string   `json:"situation"`
+	Trend      bool     `json:"trend,omitempty"`
+	Characters []string `json:"characters,omitempty"`
+	ParentIDs  []string `json:"parent_ids,omitempty"`
+}
+
+// promptDraw is the random source of a single prompt.
+type promptDraw struct {
+	seed       int64
+	rng        *rand.Rand
+	selections []PromptSelection
+	evolution  *RunEvolution
+}
+
+func newPromptDraw(seed int64) *promptDraw {
+	return &promptDraw{
+		seed: seed,
+		rng:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+func modelParamsFor(req CompletionRequest) *ModelParams {
+	return &ModelParams{Temperature: req.Temperature, MaxTokens: req.MaxTokens}
+}
+
+func NewRunConfigFromEnv() (RunConfig, error) {
+	config := RunConfig{
+		Seed:   time.Now().UnixNano(),
+		LogDir: os.Getenv("RUN_LOG_DIR"),
+	}
+
+	if value := os.Getenv("RUN_SEED"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return config, fmt.Errorf("RUN_SEED must be an integer, got %q", value)
+		}
+		config.Seed = seed
+	}
+
+	return config, nil
+}
+
+// StartRun snapshots the catalog, bandit, trends and characters and logs
+// every prompt generated from now on to dir/<run id>.json.
+func (pg *PromptGenerator) StartRun(dir string) (*RunLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create run log directory: %w", err)
+	}
+
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	run := &RunLog{
+		ID:        uuid.New().String(),
+		Seed:      pg.seed,
+		StartedAt: time.Now(),
+		Snapshot: RunSnapshot{
+			Catalog: pg.catalog,
+		},
+		Prompts: []RunPrompt{},
+	}
+	run.path = filepath.Join(dir, run.ID+".json")
+
+	if pg.bandit != nil {
+		run.Snapshot.Bandit = &BanditSnapshot{
+			Exploration: pg.bandit.config.Exploration,
+			Themes:      pg.bandit.ThemeStats(),
+			Situations:  pg.bandit.SituationStats(),
+		}
+	}
+	if pg.trends != nil {
+		run.Snapshot.Trends = &TrendSnapshot{
+			Share:  pg.trends.config.Share,
+			Themes: pg.trends.Active(),
+		}
+	}
+	if pg.characters != nil {
+		run.Snapshot.Characters = pg.characters.snapshot()
+	}
+
+	if err := writeJSONFile(run.path, run); err != nil {
+		return nil, fmt.Errorf("failed to write run log: %w", err)
+	}
+
+	pg.run = run
+	return run, nil
+}
+
+// Record adds a prompt to the run and rewrites the log, so a crashed run
+// can still be replayed up to its last prompt.
+func (r *RunLog) Record(prompt *VideoPrompt, req PromptRequest, draw *promptDraw) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prompt.RunID = r.ID
+	r.Prompts = append(r.Prompts, RunPrompt{
+		PromptID:     prompt.ID,
+		Seed:         draw.seed,
+		AccountID:    req.AccountID,
+		CharacterIDs: req.CharacterIDs,
+		Selections:   draw.selections,
+		Source:       prompt.Source,
+		Model:        prompt.Model,
+		ModelParams:  prompt.ModelParams,
+		Evolution:    draw.evolution,
+	})
+	return writeJSONFile(r.path, r)
+}
+
+func LoadRunLog(dir, id string) (*RunLog, error) {
+	path := filepath.Join(dir, id+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run log: %w", err)
+	}
+
+	var run RunLog
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to decode run log: %w", err)
+	}
+	run.path = path
+	return &run, nil
+}
+
+// replayGenerator rebuilds a generator whose picks depend only on the
+// run's snapshot. It has no model, so it can only select, not complete.
+func (r *RunLog) replayGenerator() (*PromptGenerator, error) {
+	pg := &PromptGenerator{catalog: r.Snapshot.Catalog}
+	if pg.catalog == nil {
+		return nil, fmt.Errorf("run %s has no catalog snapshot", r.ID)
+	}
+
+	if snapshot := r.Snapshot.Bandit; snapshot != nil {
+		pg.bandit = &PromptBandit{
+			config: BanditConfig{Exploration: snapshot.Exploration},
+			state: banditState{
+				Themes:     armStatsRefs(snapshot.Themes),
+				Situations: armStatsRefs(snapshot.Situations),
+				Prompts:    make(map[string]*banditPrompt),
+			},
+		}
+	}
+
+	if snapshot := r.Snapshot.Trends; snapshot != nil {
+		// Shift expiries so the themes active when the run started are
+		// active now, in the same order.
+		shift := time.Since(r.StartedAt)
+		pg.trends = NewTrendPool(TrendConfig{Share: snapshot.Share, MaxThemes: len(snapshot.Themes)})
+		for _, theme := range snapshot.Themes {
+			theme := theme
+			theme.ExpiresAt = theme.ExpiresAt.Add(shift)
+			pg.trends.themes[strings.ToLower(theme.Theme)] = &theme
+		}
+	}
+
+	if snapshot := r.Snapshot.Characters; snapshot != nil {
+		registry := NewCharacterRegistry()
+		for _, character := range snapshot.Characters {
+			if err := registry.Add(character); err != nil {
+				return nil, err
+			}
+		}
+		for accountID, cast := range snapshot.Casts {
+			if err := registry.SetCast(accountID, cast); err != nil {
+				return nil, err
+			}
+		}
+		pg.characters = registry
+	}
+
+	return pg, nil
+}
+
+func armStatsRefs(arms map[string]ArmStats) map[string]*ArmStats {
+	result := make(map[string]*ArmStats, len(arms))
+	for key, stats := range arms {
+		stats := stats
+		result[key] = &stats
+	}
+	return result
+}
+
+type ReplayResult struct {
+	PromptID string
+	Seed     int64
+	Recorded []PromptSelection
+	Replayed []PromptSelection
+}
+
+func (rr ReplayResult) Matches() bool {
+	return reflect.DeepEqual(rr.Recorded, rr.Replayed)
+}
+
+// Replay re-draws every logged prompt from its seed against the run's
+// snapshot, making as many attempts as the prompt originally took. Evolved
+// prompts re-draw their parents from the pool they were logged with.
+func (r *RunLog) Replay() ([]ReplayResult, error) {
+	pg, err := r.replayGenerator()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReplayResult, 0, len(r.Prompts))
+	for _, prompt := range r.Prompts {
+		req := PromptRequest{AccountID: prompt.AccountID, CharacterIDs: prompt.CharacterIDs}
+		draw := newPromptDraw(prompt.Seed)
+		for range prompt.Selections {
+			var err error
+			if prompt.Evolution != nil {
+				_, _, err = pg.selectParents(req, draw, prompt.Evolution)
+			} else {
+				_, _, _, err = pg.selectPrompt(req, draw)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to replay prompt %s: %w", prompt.PromptID, err)
+			}
+		}
+		results = append(results, ReplayResult{
+			PromptID: prompt.PromptID,
+			Seed:     prompt.Seed,
+			Recorded: prompt.Selections,
+			Replayed: draw.selections,
+		})
+	}
+	return results, nil
+}
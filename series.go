@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxSeriesEpisodes = 30
+	seriesPlanTokens  = 2000
+)
+
+// SeriesArc is a planned multi-episode storyline. Each episode's scenes
+// become the shot list of the video generated for it.
+type SeriesArc struct {
+	ID          string        `json:"id"`
+	Title       string        `json:"title"`
+	Premise     string        `json:"premise"`
+	AccountID   string        `json:"account_id,omitempty"`
+	Characters  []string      `json:"characters,omitempty"`
+	Episodes    []EpisodePlan `json:"episodes"`
+	NextEpisode int           `json:"next_episode"`
+	Seed        int64         `json:"seed,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+type EpisodePlan struct {
+	Number   int      `json:"number"`
+	Title    string   `json:"title"`
+	Beat     string   `json:"beat"`
+	Scenes   []string `json:"scenes"`
+	PromptID string   `json:"prompt_id,omitempty"`
+}
+
+type SeriesGenerator struct {
+	pg *PromptGenerator
+}
+
+func NewSeriesGenerator(pg *PromptGenerator) *SeriesGenerator {
+	return &SeriesGenerator{pg: pg}
+}
+
+var seriesArcSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "title": {"type": "string", "description": "short series name that reads naturally after 'Day 4 of', e.g. the cat's startup"},
+    "premise": {"type": "string", "description": "2-3 sentence premise of the whole arc"},
+    "episodes": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "title": {"type": "string"},
+          "beat": {"type": "string", "description": "what happens in this episode and how it moves the arc forward"},
+          "scenes": {"type": "array", "items": {"type": "string"}, "description": "2-4 scene prompts, each one visual moment of the 8 second video"}
+        },
+        "required": ["title", "beat", "scenes"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["title", "premise", "episodes"],
+  "additionalProperties": false
+}`)
+
+// PlanArc asks the model for a premise and per-episode beats and
+// storyboards. An empty idea lets the model pick one from the catalog
+// theme it is given.
+func (sg *SeriesGenerator) PlanArc(ctx context.Context, idea string, episodes int, req PromptRequest) (*SeriesArc, error) {
+	if episodes < 1 || episodes > maxSeriesEpisodes {
+		return nil, fmt.Errorf("series must have 1-%d episodes, got %d", maxSeriesEpisodes, episodes)
+	}
+
+	seed := sg.pg.nextSeed()
+	rng := rand.New(rand.NewSource(seed))
+
+	characters, err := sg.pg.resolveCharacters(req, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	if idea == "" {
+		theme, situation, _ := sg.pg.pickThemeAndSituation(rng)
+		idea = fmt.Sprintf("a cat dealing with \"%s\" where the cat %s", theme, situation)
+	}
+
+	systemPrompt := "You are the showrunner of a serialized post-ironic cat video series. Plan an arc that rewards viewers who come back: every episode escalates the previous one, calls back to earlier moments and ends on a small hook. Keep it weird but family-friendly. Each episode is a single 8 second video, so its scenes must be simple, concrete and visual."
+	systemPrompt += characterPromptSection(characters)
+	userPrompt := fmt.Sprintf("Plan a %d-episode series about %s. Return exactly %d episodes in order.", episodes, idea, episodes)
+
+	var arc *SeriesArc
+	_, err = sg.pg.requestStructured(ctx, CompletionRequest{
+		System:      systemPrompt,
+		User:        userPrompt,
+		MaxTokens:   seriesPlanTokens,
+		Temperature: 0.9,
+		Seed:        seed,
+		AccountID:   req.AccountID,
+	}, &JSONSchema{Name: "series_arc", Schema: seriesArcSchema}, func(text string) error {
+		var err error
+		arc, err = parseSeriesArc(text, episodes)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan series: %w", err)
+	}
+
+	arc.ID = uuid.New().String()
+	arc.AccountID = req.AccountID
+	arc.Characters = characterIDs(characters)
+	arc.NextEpisode = 1
+	arc.Seed = seed
+	arc.CreatedAt = time.Now()
+	return arc, nil
+}
+
+func parseSeriesArc(text string, episodes int) (*SeriesArc, error) {
+	var arc SeriesArc
+	if err := decodeStrictJSON(text, &arc); err != nil {
+		return nil, fmt.Errorf("reply is not a valid series arc JSON object: %w", err)
+	}
+
+	var problems []string
+	arc.Title = strings.TrimSpace(arc.Title)
+	arc.Premise = strings.TrimSpace(arc.Premise)
+	if arc.Title == "" {
+		problems = append(problems, "title is empty")
+	}
+	if arc.Premise == "" {
+		problems = append(problems, "premise is empty")
+	}
+	if len(arc.Episodes) != episodes {
+		problems = append(problems, fmt.Sprintf("expected %d episodes, got %d", episodes, len(arc.Episodes)))
+	}
+	for i := range arc.Episodes {
+		episode := &arc.Episodes[i]
+		episode.Number = i + 1
+		if strings.TrimSpace(episode.Beat) == "" {
+			problems = append(problems, fmt.Sprintf("episode %d has no beat", episode.Number))
+		}
+		if len(episode.Scenes) == 0 || len(episode.Scenes) > maxShots {
+			problems = append(problems, fmt.Sprintf("episode %d must have 1-%d scenes, got %d", episode.Number, maxShots, len(episode.Scenes)))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid series arc: %s", strings.Join(problems, "; "))
+	}
+	return &arc, nil
+}
+
+// GenerateEpisode turns one planned episode into a VideoPrompt whose shot
+// list follows the storyboard. Earlier beats are passed along as a recap so
+// callbacks stay consistent. The arc is left as it is until MarkPosted.
+func (sg *SeriesGenerator) GenerateEpisode(ctx context.Context, arc *SeriesArc, number int) (*VideoPrompt, error) {
+	if number < 1 || number > len(arc.Episodes) {
+		return nil, fmt.Errorf("series %s has no episode %d", arc.ID, number)
+	}
+	episode := &arc.Episodes[number-1]
+
+	seed := sg.pg.nextSeed()
+	characters, err := sg.pg.resolveCharacters(PromptRequest{AccountID: arc.AccountID, CharacterIDs: arc.Characters}, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		return nil, err
+	}
+
+	label := fmt.Sprintf("Day %d of %s", episode.Number, arc.Title)
+
+	var recap strings.Builder
+	for _, previous := range arc.Episodes[:number-1] {
+		fmt.Fprintf(&recap, "\n%d. %s: %s", previous.Number, previous.Title, previous.Beat)
+	}
+	if recap.Len() == 0 {
+		recap.WriteString("\nThis is the first episode.")
+	}
+
+	systemPrompt := "You are a creative director for a serialized post-ironic cat video series. Every video ships as a content package: the video prompt, what the video model must avoid, an Instagram caption and hashtags written for this exact episode, alt text, and a shot list that fits in 8 seconds."
+	systemPrompt += fmt.Sprintf("\n\nSeries: %s\nPremise: %s\nPrevious episodes:%s", arc.Title, arc.Premise, recap.String())
+	systemPrompt += characterPromptSection(characters)
+
+	userPrompt := fmt.Sprintf("Create the content package for episode %d of %d, \"%s\": %s\nThe shot list must follow this storyboard in order:\n- %s\nStart the caption with \"%s\".",
+		episode.Number, len(arc.Episodes), episode.Title, episode.Beat, strings.Join(episode.Scenes, "\n- "), label)
+
+	completionReq := CompletionRequest{
+		System:      systemPrompt,
+		User:        userPrompt,
+		MaxTokens:   contentPackageTokens,
+		Temperature: 0.8,
+		Seed:        seed,
+		AccountID:   arc.AccountID,
+	}
+	pkg, _, err := sg.pg.requestContentPackage(ctx, completionReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate episode %d: %w", episode.Number, err)
+	}
+
+	prompt := &VideoPrompt{
+		ID:            uuid.New().String(),
+		Text:          pkg.VideoPrompt,
+		Theme:         arc.Title,
+		Situation:     episode.Beat,
+		Model:         sg.pg.model.Name(),
+		Source:        PromptSourceLLM,
+		AccountID:     arc.AccountID,
+		Characters:    arc.Characters,
+		SeriesID:      arc.ID,
+		EpisodeNumber: episode.Number,
+		Seed:          seed,
+		ModelParams:   modelParamsFor(completionReq),
+		Content:       pkg,
+		CreatedAt:     time.Now(),
+	}
+
+	return prompt, nil
+}
+
+// GenerateNextEpisode generates the first episode that has not been
+// posted yet. It returns nil when the arc is finished.
+func (sg *SeriesGenerator) GenerateNextEpisode(ctx context.Context, arc *SeriesArc) (*VideoPrompt, error) {
+	if arc.NextEpisode > len(arc.Episodes) {
+		return nil, nil
+	}
+	return sg.GenerateEpisode(ctx, arc, arc.NextEpisode)
+}
+
+// MarkPosted records that prompt's episode is out and moves the arc past
+// it. It reports false for prompts that are not an episode of the arc.
+func (arc *SeriesArc) MarkPosted(prompt *VideoPrompt) bool {
+	if prompt.SeriesID != arc.ID || prompt.EpisodeNumber < 1 || prompt.EpisodeNumber > len(arc.Episodes) {
+		return false
+	}
+	arc.Episodes[prompt.EpisodeNumber-1].PromptID = prompt.ID
+	if prompt.EpisodeNumber >= arc.NextEpisode {
+		arc.NextEpisode = prompt.EpisodeNumber + 1
+	}
+	return true
+}
+
+func (arc *SeriesArc) Finished() bool {
+	return arc.NextEpisode > len(arc.Episodes)
+}
+
+func LoadSeriesArc(path string) (*SeriesArc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var arc SeriesArc
+	if err := json.Unmarshal(data, &arc); err != nil {
+		return nil, fmt.Errorf("failed to parse series arc %s: %w", path, err)
+	}
+	return &arc, nil
+}
+
+func (arc *SeriesArc) Save(path string) error {
+	return writeJSONFile(path, arc)
+}
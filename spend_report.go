@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+func spendReport() {
+	budget, err := NewBudgetFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load budget: %v", err)
+	}
+	if budget == nil {
+		log.Fatalf("BUDGET_LEDGER_PATH must point at the cost ledger to report on")
+	}
+
+	now := time.Now()
+	report := budget.Report(now)
+	fmt.Printf("💰 Spend as of %s (%s)\n", now.Format("2006-01-02 15:04"), budget.Ledger().Path())
+	if len(report) == 0 {
+		fmt.Println("No spend recorded this month")
+		return
+	}
+
+	for _, group := range report {
+		fmt.Printf("\n%s\n", group.Group)
+		fmt.Printf("   today:      %s\n", formatSpend(group.Daily, group.Caps.Daily))
+		fmt.Printf("   this week:  %s\n", formatSpend(group.Weekly, group.Caps.Weekly))
+		fmt.Printf("   this month: %s\n", formatSpend(group.Monthly, group.Caps.Monthly))
+
+		items := make([]string, 0, len(group.ByItem))
+		for item := range group.ByItem {
+			items = append(items, item)
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return group.ByItem[items[i]] > group.ByItem[items[j]]
+		})
+		for _, item := range items {
+			fmt.Printf("      %-32s $%.2f\n", item, group.ByItem[item])
+		}
+	}
+}
+
+func formatSpend(spent, limit float64) string {
+	if limit <= 0 {
+		return fmt.Sprintf("$%.2f (no cap)", spent)
+	}
+	status := ""
+	if spent >= limit {
+		status = " ⚠️  at cap"
+	}
+	return fmt.Sprintf("$%.2f of $%.2f (%.0f%%)%s", spent, limit, 100*spent/limit, status)
+}
+
+func init() {
+	// go run ... spend-report prints spend per budget group
+	if len(os.Args) > 1 && os.Args[1] == "spend-report" {
+		spendReport()
+		os.Exit(0)
+	}
+}
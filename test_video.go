@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 )
 
 func testVideoGeneration() {
@@ -12,21 +13,27 @@ func testVideoGeneration() {
 
 	ctx := context.Background()
 
-	provider := VideoProvider(getEnvWithDefault("VIDEO_PROVIDER", "veo2"))
-	fmt.Printf("Using provider: %s\n", provider)
+	videoPolicy, err := NewVideoFailoverPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid video provider config: %v", err)
+	}
+	fmt.Printf("Using provider: %s\n", videoPolicy)
 
-	videoGen, err := NewVideoGenerator(
-		os.Getenv("GEMINI_API_KEY"),
-		os.Getenv("REPLICATE_API_KEY"),
-		os.Getenv("VERTEX_API_KEY"),
-		os.Getenv("GOOGLE_PROJECT_ID"),
-		provider,
-	)
+	videoGen, err := NewVideoGenerator(ctx, videoPolicy)
 	if err != nil {
 		log.Fatalf("Failed to create video generator: %v", err)
 	}
 
-	promptGen := NewPromptGenerator(os.Getenv("OPENAI_API_KEY"))
+	promptModel, err := NewPromptModelFromEnv(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create prompt model: %v", err)
+	}
+	promptGen := NewPromptGenerator(promptModel)
+	if catalogPath := os.Getenv("PROMPT_CATALOG_PATH"); catalogPath != "" {
+		if err := promptGen.WatchCatalog(ctx, catalogPath, 10*time.Second); err != nil {
+			log.Fatalf("Failed to load prompt catalog: %v", err)
+		}
+	}
 
 	// Test 1: Generate prompt and video
 	fmt.Println("Generating a test prompt...")
@@ -46,6 +53,7 @@ func testVideoGeneration() {
 	fmt.Println("✅ Video generation successful!")
 	fmt.Printf("Video ID: %s\n", video.ID)
 	fmt.Printf("Video URL: %s\n", video.VideoURL)
+	fmt.Printf("Provider: %s\n", video.Provider)
 	fmt.Printf("Duration: %d seconds\n", video.Duration)
 
 	// Test 2: Custom prompt
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxTrendWords    = 8
+	minTrendLength   = 3
+	maxFeedBodyBytes = 5 << 20
+)
+
+// Trend is one raw topic as reported by a source.
+type Trend struct {
+	Topic       string
+	URL         string
+	PublishedAt time.Time
+	ExpiresAt   time.Time
+}
+
+// TrendSource pulls current topics from somewhere outside the catalog.
+type TrendSource interface {
+	Name() string
+	Fetch(ctx context.Context) ([]Trend, error)
+}
+
+// TrendTheme is a normalized trend usable as a prompt theme until it
+// expires. It is recorded on every prompt that used it.
+type TrendTheme struct {
+	Theme     string    `json:"theme"`
+	Source    string    `json:"source"`
+	URL       string    `json:"url,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type TrendConfig struct {
+	TTL       time.Duration
+	MaxThemes int
+	Share     float64
+	Refresh   time.Duration
+}
+
+// TrendPool merges the topics of all sources into short-lived themes.
+type TrendPool struct {
+	sources []TrendSource
+	config  TrendConfig
+	themes  map[string]*TrendTheme
+	mu      sync.RWMutex
+}
+
+func NewTrendConfigFromEnv() (TrendConfig, error) {
+	config := TrendConfig{
+		TTL:       48 * time.Hour,
+		MaxThemes: 20,
+		Share:     0.3,
+		Refresh:   30 * time.Minute,
+	}
+
+	if value := os.Getenv("TREND_TTL_HOURS"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours <= 0 {
+			return config, fmt.Errorf("TREND_TTL_HOURS must be a positive integer, got %q", value)
+		}
+		config.TTL = time.Duration(hours) * time.Hour
+	}
+
+	if value := os.Getenv("TREND_MAX_THEMES"); value != "" {
+		max, err := strconv.Atoi(value)
+		if err != nil || max <= 0 {
+			return config, fmt.Errorf("TREND_MAX_THEMES must be a positive integer, got %q", value)
+		}
+		config.MaxThemes = max
+	}
+
+	if value := os.Getenv("TREND_SHARE"); value != "" {
+		share, err := strconv.ParseFloat(value, 64)
+		if err != nil || share < 0 || share > 1 {
+			return config, fmt.Errorf("TREND_SHARE must be in [0, 1], got %q", value)
+		}
+		config.Share = share
+	}
+
+	if value := os.Getenv("TREND_REFRESH_MINUTES"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			return config, fmt.Errorf("TREND_REFRESH_MINUTES must be a positive integer, got %q", value)
+		}
+		config.Refresh = time.Duration(minutes) * time.Minute
+	}
+
+	return config, nil
+}
+
+// NewTrendPoolFromEnv builds a pool from TREND_FEEDS (RSS/Atom files or
+// URLs) and TREND_FILES (JSON files), both comma-separated. It returns nil
+// when neither is set.
+func NewTrendPoolFromEnv() (*TrendPool, error) {
+	var sources []TrendSource
+	for _, location := range splitList(os.Getenv("TREND_FEEDS")) {
+		sources = append(sources, NewFeedTrendSource(location))
+	}
+	for _, path := range splitList(os.Getenv("TREND_FILES")) {
+		sources = append(sources, NewJSONFileTrendSource(path))
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	config, err := NewTrendConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewTrendPool(config, sources...), nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func NewTrendPool(config TrendConfig, sources ...TrendSource) *TrendPool {
+	return &TrendPool{
+		sources: sources,
+		config:  config,
+		themes:  make(map[string]*TrendTheme),
+	}
+}
+
+// Refresh fetches every source and merges the results. A failing source
+// is reported but does not drop the themes it contributed earlier; they
+// simply run out their expiry.
+func (tp *TrendPool) Refresh(ctx context.Context) error {
+	now := time.Now()
+	var failures []string
+	fresh := make([]TrendTheme, 0)
+
+	for _, source := range tp.sources {
+		trends, err := source.Fetch(ctx)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", source.Name(), err))
+			continue
+		}
+
+		for _, trend := range trends {
+			theme := normalizeTrendTopic(trend.Topic)
+			if theme == "" {
+				continue
+			}
+
+			expiresAt := trend.ExpiresAt
+			if expiresAt.IsZero() {
+				seen := trend.PublishedAt
+				if seen.IsZero() || seen.After(now) {
+					seen = now
+				}
+				expiresAt = seen.Add(tp.config.TTL)
+			}
+			if !expiresAt.After(now) {
+				continue
+			}
+
+			fresh = append(fresh, TrendTheme{
+				Theme:     theme,
+				Source:    source.Name(),
+				URL:       trend.URL,
+				FirstSeen: now,
+				ExpiresAt: expiresAt,
+			})
+		}
+	}
+
+	tp.mu.Lock()
+	for _, theme := range fresh {
+		key := strings.ToLower(theme.Theme)
+		if existing, ok := tp.themes[key]; ok {
+			if theme.ExpiresAt.After(existing.ExpiresAt) {
+				existing.ExpiresAt = theme.ExpiresAt
+			}
+			continue
+		}
+		theme := theme
+		tp.themes[key] = &theme
+	}
+	tp.pruneLocked(now)
+	tp.mu.Unlock()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to fetch trends: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// pruneLocked drops expired themes and, above MaxThemes, the ones that
+// expire soonest.
+func (tp *TrendPool) pruneLocked(now time.Time) {
+	for key, theme := range tp.themes {
+		if !theme.ExpiresAt.After(now) {
+			delete(tp.themes, key)
+		}
+	}
+	if len(tp.themes) <= tp.config.MaxThemes {
+		return
+	}
+
+	keys := make([]string, 0, len(tp.themes))
+	for key := range tp.themes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return tp.themes[keys[i]].ExpiresAt.After(tp.themes[keys[j]].ExpiresAt)
+	})
+	for _, key := range keys[tp.config.MaxThemes:] {
+		delete(tp.themes, key)
+	}
+}
+
+// Active returns the unexpired themes, latest expiry first. Ties are broken
+// by theme so seeded picks do not depend on map order.
+func (tp *TrendPool) Active() []TrendTheme {
+	now := time.Now()
+
+	tp.mu.RLock()
+	defer tp.mu.RUnlock()
+
+	active := make([]TrendTheme, 0, len(tp.themes))
+	for _, theme := range tp.themes {
+		if theme.ExpiresAt.After(now) {
+			active = append(active, *theme)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if !active[i].ExpiresAt.Equal(active[j].ExpiresAt) {
+			return active[i].ExpiresAt.After(active[j].ExpiresAt)
+		}
+		return active[i].Theme < active[j].Theme
+	})
+	return active
+}
+
+// pick returns an active trend theme for roughly Share of the calls, or
+// nil when the catalog should be used.
+func (tp *TrendPool) pick(rng *rand.Rand) *TrendTheme {
+	if rng.Float64() >= tp.config.Share {
+		return nil
+	}
+	active := tp.Active()
+	if len(active) == 0 {
+		return nil
+	}
+	theme := active[rng.Intn(len(active))]
+	return &theme
+}
+
+// Watch refreshes once and then every config.Refresh until ctx is done.
+// Source failures are logged; the pool keeps serving what it has.
+func (tp *TrendPool) Watch(ctx context.Context) {
+	if err := tp.Refresh(ctx); err != nil {
+		fmt.Printf("Some trend sources failed: %v\n", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(tp.config.Refresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := tp.Refresh(ctx); err != nil {
+				fmt.Printf("Some trend sources failed: %v\n", err)
+			}
+		}
+	}()
+}
+
+func (pg *PromptGenerator) SetTrends(trends *TrendPool) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	pg.trends = trends
+}
+
+var (
+	trendTagPattern    = regexp.MustCompile(`<[^>]*>`)
+	trendSpacePattern  = regexp.MustCompile(`\s+`)
+	trendSuffixPattern = regexp.MustCompile(`\s+[-|–—]\s+[^-|–—]+$`)
+)
+
+// normalizeTrendTopic turns a headline into a short lowercase theme:
+// markup, publisher suffixes ("... - Site Name") and trailing punctuation
+// are removed and long headlines are cut to maxTrendWords words.
+func normalizeTrendTopic(topic string) string {
+	topic = html.UnescapeString(trendTagPattern.ReplaceAllString(topic, " "))
+	topic = strings.TrimSpace(trendSpacePattern.ReplaceAllString(topic, " "))
+	topic = trendSuffixPattern.ReplaceAllString(topic, "")
+	topic = strings.Trim(topic, " .,:;!?\"'")
+
+	words := strings.Fields(topic)
+	if len(words) > maxTrendWords {
+		words = words[:maxTrendWords]
+	}
+	topic = strings.ToLower(strings.Join(words, " "))
+
+	if len(topic) < minTrendLength {
+		return ""
+	}
+	return topic
+}
+
+// FeedTrendSource reads item titles from an RSS 2.0, RSS 1.0 or Atom feed
+// stored in a local file or served over HTTP.
+type FeedTrendSource struct {
+	location string
+	client   *http.Client
+}
+
+type feedDocument struct {
+	Channel struct {
+		Items []feedItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []feedItem  `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type feedItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"date"`
+}
+
+type atomEntry struct {
+	Title     string `xml:"title"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Links     []struct {
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+}
+
+func NewFeedTrendSource(location string) *FeedTrendSource {
+	return &FeedTrendSource{
+		location: location,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *FeedTrendSource) Name() string {
+	return "feed:" + s.location
+}
+
+func (s *FeedTrendSource) Fetch(ctx context.Context) ([]Trend, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc feedDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+
+	trends := make([]Trend, 0, len(doc.Channel.Items)+len(doc.Items)+len(doc.Entries))
+	for _, item := range append(doc.Channel.Items, doc.Items...) {
+		date := item.PubDate
+		if date == "" {
+			date = item.Date
+		}
+		trends = append(trends, Trend{
+			Topic:       item.Title,
+			URL:         strings.TrimSpace(item.Link),
+			PublishedAt: parseFeedTime(date),
+		})
+	}
+	for _, entry := range doc.Entries {
+		date := entry.Published
+		if date == "" {
+			date = entry.Updated
+		}
+		trend := Trend{Topic: entry.Title, PublishedAt: parseFeedTime(date)}
+		if len(entry.Links) > 0 {
+			trend.URL = entry.Links[0].Href
+		}
+		trends = append(trends, trend)
+	}
+
+	return trends, nil
+}
+
+func (s *FeedTrendSource) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.location, "http://") && !strings.HasPrefix(s.location, "https://") {
+		data, err := os.ReadFile(s.location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read feed: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create feed request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+	return data, nil
+}
+
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2006-01-02",
+}
+
+// parseFeedTime returns the zero time for dates it cannot read; such items
+// are treated as published now.
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// JSONFileTrendSource reads a JSON array of topics, for hand-curated or
+// externally scraped trend lists. Entries may be plain strings or objects
+// with topic, url, published_at and expires_at.
+type JSONFileTrendSource struct {
+	path string
+}
+
+type jsonTrend struct {
+	Topic       string    `json:"topic"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func NewJSONFileTrendSource(path string) *JSONFileTrendSource {
+	return &JSONFileTrendSource{path: path}
+}
+
+func (s *JSONFileTrendSource) Name() string {
+	return "file:" + s.path
+}
+
+func (s *JSONFileTrendSource) Fetch(ctx context.Context) ([]Trend, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trend file: %w", err)
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("trend file must be a JSON array: %w", err)
+	}
+
+	trends := make([]Trend, 0, len(raw))
+	for i, entry := range raw {
+		var topic string
+		if err := json.Unmarshal(entry, &topic); err == nil {
+			trends = append(trends, Trend{Topic: topic})
+			continue
+		}
+
+		var trend jsonTrend
+		if err := json.Unmarshal(entry, &trend); err != nil {
+			return nil, fmt.Errorf("trend file entry %d: %w", i+1, err)
+		}
+		trends = append(trends, Trend{
+			Topic:       trend.Topic,
+			URL:         trend.URL,
+			PublishedAt: trend.PublishedAt,
+			ExpiresAt:   trend.ExpiresAt,
+		})
+	}
+	return trends, nil
+}
@@ -3,18 +3,71 @@ package main
 import "time"
 
 type VideoPrompt struct {
-	ID        string    `json:"id"`
-	Text      string    `json:"text"`
-	Theme     string    `json:"theme"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             string             `json:"id"`
+	Text           string             `json:"text"`
+	Theme          string             `json:"theme"`
+	Situation      string             `json:"situation,omitempty"`
+	Model          string             `json:"model,omitempty"`
+	Source         PromptSource       `json:"source"`
+	FallbackReason string             `json:"fallback_reason,omitempty"`
+	AccountID      string             `json:"account_id,omitempty"`
+	Characters     []string           `json:"characters,omitempty"`
+	SeriesID       string             `json:"series_id,omitempty"`
+	EpisodeNumber  int                `json:"episode_number,omitempty"`
+	ParentIDs      []string           `json:"parent_ids,omitempty"`
+	Generation     int                `json:"generation,omitempty"`
+	Trend          *TrendTheme        `json:"trend,omitempty"`
+	Seed           int64              `json:"seed,omitempty"`
+	ModelParams    *ModelParams       `json:"model_params,omitempty"`
+	RunID          string             `json:"run_id,omitempty"`
+	Novelty        *NoveltyResult     `json:"novelty,omitempty"`
+	Score          *PromptScore       `json:"score,omitempty"`
+	Content        *ContentPackage    `json:"content,omitempty"`
+	Moderation     *ModerationVerdict `json:"moderation,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+// ModelParams are the sampling settings a prompt was generated with.
+type ModelParams struct {
+	Temperature float32 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens"`
+}
+
+type ContentPackage struct {
+	VideoPrompt    string                       `json:"video_prompt"`
+	NegativePrompt string                       `json:"negative_prompt"`
+	Caption        string                       `json:"caption"`
+	Hashtags       []string                     `json:"hashtags"`
+	AltText        string                       `json:"alt_text"`
+	OnScreenText   string                       `json:"on_screen_text"`
+	ShotList       []Shot                       `json:"shot_list"`
+	Language       string                       `json:"language,omitempty"`
+	Localized      map[string]*LocalizedContent `json:"localized,omitempty"`
+}
+
+type Shot struct {
+	Description     string  `json:"description"`
+	DurationSeconds float64 `json:"duration_seconds"`
 }
 
 type GeneratedVideo struct {
-	ID        string    `json:"id"`
-	PromptID  string    `json:"prompt_id"`
-	VideoURL  string    `json:"video_url"`
-	Duration  int       `json:"duration"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         string          `json:"id"`
+	PromptID   string          `json:"prompt_id"`
+	AccountID  string          `json:"account_id,omitempty"`
+	VideoURL   string          `json:"video_url"`
+	LocalPath  string          `json:"local_path,omitempty"`
+	Provider   VideoProvider   `json:"provider"`
+	FailedOver []VideoProvider `json:"failed_over,omitempty"`
+	OverBudget []VideoProvider `json:"over_budget,omitempty"`
+	Cost       float64         `json:"cost_usd,omitempty"`
+	// AssetSHA256 keys the video in the AssetStore once it is downloaded.
+	AssetSHA256 string `json:"asset_sha256,omitempty"`
+	// Duration is the provider's nominal length until the file has been
+	// inspected, then Metadata's rounded to whole seconds.
+	Duration  int             `json:"duration"`
+	Metadata  *VideoMetadata  `json:"metadata,omitempty"`
+	Content   *ContentPackage `json:"content,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
 }
 
 type InstagramAccount struct {
@@ -23,11 +76,13 @@ type InstagramAccount struct {
 	AccessToken   string `json:"access_token"`
 	IsMainAccount bool   `json:"is_main_account"`
 	IsActive      bool   `json:"is_active"`
+	Locale        string `json:"locale,omitempty"`
 }
 
 type PostPerformance struct {
 	PostID         string    `json:"post_id"`
 	AccountID      string    `json:"account_id"`
+	PromptID       string    `json:"prompt_id,omitempty"`
 	Likes          int       `json:"likes"`
 	Comments       int       `json:"comments"`
 	Shares         int       `json:"shares"`
@@ -45,7 +100,7 @@ type OptimalTimeSlot struct {
 type VideoProvider string
 
 const (
-	Veo2           VideoProvider = "veo2"
-	Veo3Replicate  VideoProvider = "veo3-replicate"
-	Veo3Vertex     VideoProvider = "veo3-vertex"
-)
\ No newline at end of file
+	Veo2          VideoProvider = "veo2"
+	Veo3Replicate VideoProvider = "veo3-replicate"
+	Veo3Vertex    VideoProvider = "veo3-vertex"
+)
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	veo2Model        = "veo-2.0-generate-001"
+	geminiAPIBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	veo2PollInterval = 10 * time.Second
+	veo2PollTimeout  = 10 * time.Minute
+)
+
+var veo2Capabilities = VideoCapabilities{
+	MaxDurationSeconds: 8,
+	AspectRatios:       []string{"16:9", "9:16"},
+	Audio:              false,
+	ImageInput:         true,
+	PricePerSecond:     0.35,
+}
+
+// veo2Backend drives Veo 2 through the Gemini API's long-running
+// predictLongRunning operation: submit, poll until done, then fetch the
+// generated file.
+type veo2Backend struct {
+	apiKey      string
+	duration    int
+	aspectRatio string
+	downloadDir string
+	client      *http.Client
+}
+
+func init() {
+	RegisterVideoBackend(VideoBackendSpec{
+		Provider:     Veo2,
+		Capabilities: veo2Capabilities,
+		Env: map[string]string{
+			"GEMINI_API_KEY": "Gemini API key for Veo 2 video generation",
+		},
+		Validate: func() error {
+			if _, err := veo2DurationFromEnv(); err != nil {
+				return err
+			}
+			if aspectRatio := getEnvWithDefault("VEO2_ASPECT_RATIO", "9:16"); !supportsAspectRatio(veo2Capabilities, aspectRatio) {
+				return fmt.Errorf("VEO2_ASPECT_RATIO must be one of %s, got %q", strings.Join(veo2Capabilities.AspectRatios, ", "), aspectRatio)
+			}
+			return nil
+		},
+		PrivateURLs: true,
+		Limits:      VideoLimits{Concurrency: 2, RequestsPerMinute: 10},
+		New:         newVeo2Backend,
+	})
+}
+
+func newVeo2Backend(ctx context.Context) (VideoBackend, error) {
+	duration, err := veo2DurationFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	downloadDir := os.Getenv("VEO2_DOWNLOAD_DIR")
+	if downloadDir != "" {
+		if err := os.MkdirAll(downloadDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create Veo 2 download directory: %w", err)
+		}
+	}
+
+	return &veo2Backend{
+		apiKey:      os.Getenv("GEMINI_API_KEY"),
+		duration:    duration,
+		aspectRatio: getEnvWithDefault("VEO2_ASPECT_RATIO", "9:16"),
+		downloadDir: downloadDir,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func veo2DurationFromEnv() (int, error) {
+	value := getEnvWithDefault("VEO2_DURATION_SECONDS", "8")
+	duration, err := strconv.Atoi(value)
+	if err != nil || duration < 5 || duration > veo2Capabilities.MaxDurationSeconds {
+		return 0, fmt.Errorf("VEO2_DURATION_SECONDS must be between 5 and %d, got %q", veo2Capabilities.MaxDurationSeconds, value)
+	}
+	return duration, nil
+}
+
+func supportsAspectRatio(capabilities VideoCapabilities, aspectRatio string) bool {
+	for _, supported := range capabilities.AspectRatios {
+		if supported == aspectRatio {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *veo2Backend) Name() VideoProvider {
+	return Veo2
+}
+
+func (b *veo2Backend) Capabilities() VideoCapabilities {
+	return veo2Capabilities
+}
+
+type veo2Operation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Response *struct {
+		GenerateVideoResponse struct {
+			GeneratedSamples []struct {
+				Video struct {
+					URI string `json:"uri"`
+				} `json:"video"`
+			} `json:"generatedSamples"`
+			RAIMediaFilteredCount   int      `json:"raiMediaFilteredCount"`
+			RAIMediaFilteredReasons []string `json:"raiMediaFilteredReasons"`
+		} `json:"generateVideoResponse"`
+	} `json:"response"`
+}
+
+func (b *veo2Backend) Generate(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
+	operationName, err := b.Submit(ctx, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("Veo 2 generation failed: %w", err)
+	}
+	return b.Await(ctx, prompt, operationName)
+}
+
+// Await polls a submitted operation and fetches its video.
+func (b *veo2Backend) Await(ctx context.Context, prompt *VideoPrompt, operationName string) (*GeneratedVideo, error) {
+	// The Gemini API cannot cancel video operations, so a cancelled ctx
+	// only stops polling.
+	operation, err := b.poll(ctx, operationName)
+	if err != nil {
+		return nil, fmt.Errorf("Veo 2 generation failed: %w", err)
+	}
+
+	videoURI, err := veo2VideoURI(operation)
+	if err != nil {
+		return nil, err
+	}
+
+	video := &GeneratedVideo{
+		ID:        uuid.New().String(),
+		PromptID:  prompt.ID,
+		VideoURL:  videoURI,
+		Duration:  b.duration,
+		CreatedAt: time.Now(),
+	}
+
+	// The video is rendered and billed by now, so a failed download only
+	// leaves LocalPath empty; the asset store fetches it again.
+	if b.downloadDir != "" {
+		path := filepath.Join(b.downloadDir, video.ID+".mp4")
+		if err := b.download(ctx, video, path); err != nil {
+			fmt.Printf("Failed to download Veo 2 video %s: %v\n", video.ID, err)
+		} else {
+			video.LocalPath = path
+		}
+	}
+
+	return video, nil
+}
+
+// Submit starts a predictLongRunning operation and returns its name.
+func (b *veo2Backend) Submit(ctx context.Context, prompt *VideoPrompt) (string, error) {
+	requestBody := map[string]interface{}{
+		"instances": []map[string]interface{}{
+			{"prompt": prompt.Text},
+		},
+		"parameters": map[string]interface{}{
+			"aspectRatio":      b.aspectRatio,
+			"durationSeconds":  b.duration,
+			"sampleCount":      1,
+			"negativePrompt":   negativePrompt(prompt),
+			"personGeneration": "dont_allow",
+		},
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:predictLongRunning", geminiAPIBaseURL, veo2Model)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var operation veo2Operation
+	if err := b.do(req, &operation); err != nil {
+		return "", err
+	}
+	if operation.Name == "" {
+		return "", fmt.Errorf("no operation name in response")
+	}
+	return operation.Name, nil
+}
+
+// poll waits for the operation to finish. Veo 2 usually takes one to three
+// minutes; after veo2PollTimeout the run gives up. Polls that fail because
+// the API is unavailable or rate limited are retried on the next tick.
+func (b *veo2Backend) poll(ctx context.Context, operationName string) (*veo2Operation, error) {
+	ctx, cancel := context.WithTimeout(ctx, veo2PollTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(veo2PollInterval)
+	defer ticker.Stop()
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", geminiAPIBaseURL+"/"+operationName, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create poll request: %w", err)
+		}
+
+		var operation veo2Operation
+		if err := b.do(req, &operation); err != nil {
+			if ctx.Err() != nil || !isTransientVideoError(err) {
+				return nil, fmt.Errorf("failed to poll operation: %w", err)
+			}
+			fmt.Printf("Veo 2 poll %d failed, retrying: %v\n", attempt, err)
+		} else if operation.Done {
+			return &operation, nil
+		} else {
+			fmt.Printf("Veo 2 generation in progress... (poll %d)\n", attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("operation %s did not finish: %w", operationName, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// veo2VideoURI extracts the video from a finished operation. Operations
+// whose only sample was removed by the safety filters fail with
+// ErrVideoFiltered and the reasons Google gave.
+func veo2VideoURI(operation *veo2Operation) (string, error) {
+	if operation.Error != nil {
+		return "", fmt.Errorf("Veo 2 operation failed: %s (code %d)", operation.Error.Message, operation.Error.Code)
+	}
+	if operation.Response == nil {
+		return "", fmt.Errorf("Veo 2 operation finished without a response")
+	}
+
+	result := operation.Response.GenerateVideoResponse
+	for _, sample := range result.GeneratedSamples {
+		if sample.Video.URI != "" {
+			return sample.Video.URI, nil
+		}
+	}
+
+	if result.RAIMediaFilteredCount > 0 {
+		reasons := strings.Join(result.RAIMediaFilteredReasons, "; ")
+		if reasons == "" {
+			reasons = "no reason given"
+		}
+		return "", fmt.Errorf("%w: Veo 2 filtered %d video(s): %s", ErrVideoFiltered, result.RAIMediaFilteredCount, reasons)
+	}
+	return "", fmt.Errorf("Veo 2 operation finished without a video")
+}
+
+// Fetch downloads a generated video. Gemini file URIs need the API key, so
+// they cannot be handed to Instagram directly.
+func (b *veo2Backend) Fetch(ctx context.Context, video *GeneratedVideo) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", video.VideoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %w", err)
+	}
+	req.Header.Set("x-goog-api-key", b.apiKey)
+
+	// The download can take longer than the API timeout.
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("download failed: %w", &VideoHTTPError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+	return resp.Body, nil
+}
+
+func (b *veo2Backend) download(ctx context.Context, video *GeneratedVideo, path string) error {
+	body, err := b.Fetch(ctx, video)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+func (b *veo2Backend) do(req *http.Request, result interface{}) error {
+	req.Header.Set("x-goog-api-key", b.apiKey)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &VideoHTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
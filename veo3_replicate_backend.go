@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/replicate/replicate-go"
+)
+
+var veo3ReplicateCapabilities = VideoCapabilities{
+	MaxDurationSeconds: 8,
+	AspectRatios:       []string{"16:9", "9:16"},
+	Audio:              true,
+	ImageInput:         true,
+	PricePerSecond:     0.75,
+}
+
+type veo3ReplicateBackend struct {
+	client   *replicate.Client
+	webhooks *ReplicateWebhookServer
+}
+
+func init() {
+	RegisterVideoBackend(VideoBackendSpec{
+		Provider:     Veo3Replicate,
+		Capabilities: veo3ReplicateCapabilities,
+		Env: map[string]string{
+			"REPLICATE_API_KEY": "Replicate API key for Veo 3 video generation",
+		},
+		Limits: VideoLimits{Concurrency: 4, RequestsPerMinute: 60},
+		New:    newVeo3ReplicateBackend,
+	})
+}
+
+func newVeo3ReplicateBackend(ctx context.Context) (VideoBackend, error) {
+	client, err := replicate.NewClient(replicate.WithToken(os.Getenv("REPLICATE_API_KEY")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Replicate client: %w", err)
+	}
+	return &veo3ReplicateBackend{client: client}, nil
+}
+
+func (b *veo3ReplicateBackend) Name() VideoProvider {
+	return Veo3Replicate
+}
+
+func (b *veo3ReplicateBackend) Capabilities() VideoCapabilities {
+	return veo3ReplicateCapabilities
+}
+
+// SetWebhooks has predictions report completion to the webhook server.
+// They are still polled, less often, in case a webhook never arrives. A
+// webhook only wakes the goroutine waiting in Await sooner; it does not
+// replace it.
+func (b *veo3ReplicateBackend) SetWebhooks(webhooks *ReplicateWebhookServer) {
+	b.webhooks = webhooks
+}
+
+func (b *veo3ReplicateBackend) Generate(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
+	predictionID, err := b.Submit(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return b.Await(ctx, prompt, predictionID)
+}
+
+// Submit creates the prediction and returns its ID.
+func (b *veo3ReplicateBackend) Submit(ctx context.Context, prompt *VideoPrompt) (string, error) {
+	input := replicate.PredictionInput{
+		"prompt":          prompt.Text,
+		"enhance_prompt":  true,
+		"negative_prompt": negativePrompt(prompt),
+	}
+
+	var webhook *replicate.Webhook
+	if b.webhooks != nil {
+		webhook = b.webhooks.Webhook()
+	}
+
+	prediction, err := b.client.CreatePrediction(ctx, "google/veo-3", input, webhook, false)
+	if err != nil {
+		return "", fmt.Errorf("Veo 3 Replicate generation failed: %w", err)
+	}
+	return prediction.ID, nil
+}
+
+// Await waits for a prediction to finish. Cancelling ctx cancels the
+// prediction.
+func (b *veo3ReplicateBackend) Await(ctx context.Context, prompt *VideoPrompt, predictionID string) (*GeneratedVideo, error) {
+	prediction, err := b.wait(ctx, predictionID)
+	if err != nil {
+		if ctx.Err() != nil {
+			cancelRemote(ctx, "Replicate prediction "+predictionID, func(ctx context.Context) error {
+				return b.Cancel(ctx, predictionID)
+			})
+		}
+		return nil, fmt.Errorf("Veo 3 Replicate wait failed: %w", err)
+	}
+	if prediction.Status != replicate.Succeeded {
+		return nil, fmt.Errorf("Veo 3 Replicate prediction %s: %w", prediction.Status, &replicate.ModelError{Prediction: prediction})
+	}
+
+	videoURL, ok := prediction.Output.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected output format from Veo 3 Replicate")
+	}
+
+	return &GeneratedVideo{
+		ID:        uuid.New().String(),
+		PromptID:  prompt.ID,
+		VideoURL:  videoURL,
+		Duration:  8,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (b *veo3ReplicateBackend) Cancel(ctx context.Context, predictionID string) error {
+	_, err := b.client.CancelPrediction(ctx, predictionID)
+	return err
+}
+
+func (b *veo3ReplicateBackend) wait(ctx context.Context, predictionID string) (*replicate.Prediction, error) {
+	if b.webhooks == nil {
+		prediction, err := b.client.GetPrediction(ctx, predictionID)
+		if err != nil {
+			return nil, err
+		}
+		return prediction, b.client.Wait(ctx, prediction)
+	}
+
+	// Subscribe before the first poll so a webhook arriving in between is
+	// not missed.
+	done, unsubscribe := b.webhooks.Subscribe(predictionID)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(b.webhooks.PollInterval())
+	defer ticker.Stop()
+	for {
+		prediction, err := b.client.GetPrediction(ctx, predictionID)
+		if err != nil {
+			return nil, err
+		}
+		if prediction.Status.Terminated() {
+			return prediction, nil
+		}
+
+		select {
+		case prediction := <-done:
+			return prediction, nil
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
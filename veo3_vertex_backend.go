@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var veo3VertexCapabilities = VideoCapabilities{
+	MaxDurationSeconds: 8,
+	AspectRatios:       []string{"16:9", "9:16"},
+	Audio:              true,
+	ImageInput:         true,
+	PricePerSecond:     0.75,
+}
+
+var googleProjectIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+type veo3VertexBackend struct {
+	apiKey    string
+	projectID string
+}
+
+func init() {
+	RegisterVideoBackend(VideoBackendSpec{
+		Provider:     Veo3Vertex,
+		Capabilities: veo3VertexCapabilities,
+		Env: map[string]string{
+			"VERTEX_API_KEY":    "Vertex AI access token for Veo 3 video generation",
+			"GOOGLE_PROJECT_ID": "Google Cloud project ID for Vertex AI",
+		},
+		Validate: func() error {
+			if projectID := os.Getenv("GOOGLE_PROJECT_ID"); !googleProjectIDPattern.MatchString(projectID) {
+				return fmt.Errorf("GOOGLE_PROJECT_ID %q is not a valid project ID", projectID)
+			}
+			return nil
+		},
+		Limits: VideoLimits{Concurrency: 2, RequestsPerMinute: 10},
+		New:    newVeo3VertexBackend,
+	})
+}
+
+// No client is needed for Vertex AI; requests go over plain HTTP.
+func newVeo3VertexBackend(ctx context.Context) (VideoBackend, error) {
+	return &veo3VertexBackend{
+		apiKey:    os.Getenv("VERTEX_API_KEY"),
+		projectID: os.Getenv("GOOGLE_PROJECT_ID"),
+	}, nil
+}
+
+func (b *veo3VertexBackend) Name() VideoProvider {
+	return Veo3Vertex
+}
+
+func (b *veo3VertexBackend) Capabilities() VideoCapabilities {
+	return veo3VertexCapabilities
+}
+
+func (b *veo3VertexBackend) Generate(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
+	operationName, err := b.Submit(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return b.Await(ctx, prompt, operationName)
+}
+
+// Submit starts a predictLongRunning operation and returns its name.
+func (b *veo3VertexBackend) Submit(ctx context.Context, prompt *VideoPrompt) (string, error) {
+	endpoint := fmt.Sprintf("https://aiplatform.googleapis.com/v1/projects/%s/locations/us-central1/publishers/google/models/veo-3.0-generate-preview:predictLongRunning", b.projectID)
+
+	requestBody := map[string]interface{}{
+		"instances": []map[string]interface{}{
+			{"prompt": prompt.Text},
+		},
+		"parameters": map[string]interface{}{
+			"aspectRatio":     "9:16",
+			"durationSeconds": 8,
+			"numberOfVideos":  1,
+			"negativePrompt":  negativePrompt(prompt),
+		},
+	}
+
+	jsonBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Vertex AI request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("Vertex AI request failed: %w", &VideoHTTPError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	operationName, ok := result["name"].(string)
+	if !ok {
+		return "", fmt.Errorf("no operation name in response")
+	}
+	return operationName, nil
+}
+
+// Await polls a submitted operation. Cancelling ctx cancels the operation.
+func (b *veo3VertexBackend) Await(ctx context.Context, prompt *VideoPrompt, operationName string) (*GeneratedVideo, error) {
+	videoURL, err := b.pollOperation(ctx, operationName)
+	if err != nil {
+		if ctx.Err() != nil {
+			cancelRemote(ctx, "Vertex AI operation "+operationName, func(ctx context.Context) error {
+				return b.Cancel(ctx, operationName)
+			})
+		}
+		return nil, fmt.Errorf("failed to poll operation: %w", err)
+	}
+
+	return &GeneratedVideo{
+		ID:        uuid.New().String(),
+		PromptID:  prompt.ID,
+		VideoURL:  videoURL,
+		Duration:  8,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// pollOperation waits for the operation's video. Polls that fail because
+// Vertex AI is unavailable or rate limited are retried at the next attempt.
+func (b *veo3VertexBackend) pollOperation(ctx context.Context, operationName string) (string, error) {
+	maxAttempts := 30
+	delay := 10 * time.Second
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		default:
+		}
+
+		operation, err := b.getOperation(ctx, operationName)
+		if err != nil {
+			if ctx.Err() != nil || !isTransientVideoError(err) {
+				return "", err
+			}
+			fmt.Printf("Video generation poll failed, retrying (attempt %d/%d): %v\n", attempt+1, maxAttempts, err)
+		} else if done, ok := operation["done"].(bool); ok && done {
+			if errorObj, exists := operation["error"]; exists {
+				return "", fmt.Errorf("operation failed: %v", errorObj)
+			}
+
+			if response, ok := operation["response"].(map[string]interface{}); ok {
+				if predictions, ok := response["predictions"].([]interface{}); ok && len(predictions) > 0 {
+					if prediction, ok := predictions[0].(map[string]interface{}); ok {
+						if videoURL, ok := prediction["videoUrl"].(string); ok {
+							return videoURL, nil
+						}
+					}
+				}
+			}
+
+			return "", fmt.Errorf("no video URL in completed operation")
+		} else {
+			fmt.Printf("Video generation in progress... (attempt %d/%d)\n", attempt+1, maxAttempts)
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	return "", fmt.Errorf("video generation timed out")
+}
+
+func (b *veo3VertexBackend) getOperation(ctx context.Context, operationName string) (map[string]interface{}, error) {
+	endpoint := fmt.Sprintf("https://aiplatform.googleapis.com/v1/%s", operationName)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create poll request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+b.apiKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll operation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to poll operation: %w", &VideoHTTPError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	var operation map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&operation); err != nil {
+		return nil, fmt.Errorf("failed to decode poll response: %w", err)
+	}
+	return operation, nil
+}
+
+func (b *veo3VertexBackend) Cancel(ctx context.Context, operationName string) error {
+	endpoint := fmt.Sprintf("https://aiplatform.googleapis.com/v1/%s:cancel", operationName)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create cancel request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+b.apiKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cancel request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &VideoHTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return nil
+}
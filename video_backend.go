@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VideoBackend is one text-to-video provider. Backends register a
+// VideoBackendSpec from an init function, so adding a provider means adding
+// a file rather than editing VideoGenerator.
+type VideoBackend interface {
+	Name() VideoProvider
+	Capabilities() VideoCapabilities
+	Generate(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error)
+}
+
+// ResumableVideoBackend splits generation into submitting the job and
+// awaiting it by the provider's ID for it, so a job submitted by a process
+// that died can be picked up again by the next one.
+type ResumableVideoBackend interface {
+	VideoBackend
+	Submit(ctx context.Context, prompt *VideoPrompt) (string, error)
+	Await(ctx context.Context, prompt *VideoPrompt, remoteID string) (*GeneratedVideo, error)
+}
+
+// VideoFetcher is implemented by backends whose video URLs need the
+// provider's credentials to download.
+type VideoFetcher interface {
+	Fetch(ctx context.Context, video *GeneratedVideo) (io.ReadCloser, error)
+}
+
+// VideoCanceller is implemented by resumable backends that can stop a
+// submitted job.
+type VideoCanceller interface {
+	Cancel(ctx context.Context, remoteID string) error
+}
+
+type VideoCapabilities struct {
+	MaxDurationSeconds int      `json:"max_duration_seconds"`
+	AspectRatios       []string `json:"aspect_ratios"`
+	Audio              bool     `json:"audio"`
+	ImageInput         bool     `json:"image_input"`
+	// PricePerSecond is the list price in USD per second of video.
+	PricePerSecond float64 `json:"price_per_second"`
+}
+
+type VideoBackendSpec struct {
+	Provider     VideoProvider
+	Capabilities VideoCapabilities
+	// Env maps each environment variable the backend needs to what it is
+	// used for.
+	Env map[string]string
+	// Validate checks the backend's settings beyond the presence of Env.
+	// It is optional.
+	Validate func() error
+	// PrivateURLs means the backend's video URLs need its credentials to
+	// download, so Instagram cannot fetch them.
+	PrivateURLs bool
+	// Limits are the default concurrency and submission rate, see
+	// LimitsFromEnv.
+	Limits VideoLimits
+	New    func(ctx context.Context) (VideoBackend, error)
+}
+
+var (
+	videoBackends   = make(map[VideoProvider]VideoBackendSpec)
+	videoBackendsMu sync.RWMutex
+)
+
+// RegisterVideoBackend makes a backend available under spec.Provider. It
+// panics on duplicate or incomplete registrations, which are programming
+// errors.
+func RegisterVideoBackend(spec VideoBackendSpec) {
+	if spec.Provider == "" || spec.New == nil {
+		panic("video backend registration needs a provider and a constructor")
+	}
+
+	videoBackendsMu.Lock()
+	defer videoBackendsMu.Unlock()
+
+	if _, exists := videoBackends[spec.Provider]; exists {
+		panic(fmt.Sprintf("video backend %s registered twice", spec.Provider))
+	}
+	videoBackends[spec.Provider] = spec
+}
+
+func LookupVideoBackend(provider VideoProvider) (VideoBackendSpec, bool) {
+	videoBackendsMu.RLock()
+	defer videoBackendsMu.RUnlock()
+	spec, ok := videoBackends[provider]
+	return spec, ok
+}
+
+// VideoBackends returns every registered backend, sorted by provider.
+func VideoBackends() []VideoBackendSpec {
+	videoBackendsMu.RLock()
+	defer videoBackendsMu.RUnlock()
+
+	specs := make([]VideoBackendSpec, 0, len(videoBackends))
+	for _, spec := range videoBackends {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Provider < specs[j].Provider
+	})
+	return specs
+}
+
+func videoProviderNames() string {
+	specs := VideoBackends()
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, string(spec.Provider))
+	}
+	return strings.Join(names, ", ")
+}
+
+// MissingEnv returns the backend's required environment variables that
+// are not set, sorted by name.
+func (spec VideoBackendSpec) MissingEnv() []string {
+	var missing []string
+	for env := range spec.Env {
+		if os.Getenv(env) == "" {
+			missing = append(missing, env)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// CheckConfig reports missing environment variables and invalid settings.
+func (spec VideoBackendSpec) CheckConfig() error {
+	if missing := spec.MissingEnv(); len(missing) == 1 {
+		return fmt.Errorf("%s is required for %s provider", missing[0], spec.Provider)
+	} else if len(missing) > 1 {
+		return fmt.Errorf("%s are required for %s provider", strings.Join(missing, " and "), spec.Provider)
+	}
+	if spec.Validate != nil {
+		if err := spec.Validate(); err != nil {
+			return fmt.Errorf("invalid %s config: %w", spec.Provider, err)
+		}
+	}
+	if _, err := spec.LimitsFromEnv(); err != nil {
+		return fmt.Errorf("invalid %s config: %w", spec.Provider, err)
+	}
+	return nil
+}
+
+// NewVideoBackend validates the provider's configuration and creates it.
+func NewVideoBackend(ctx context.Context, provider VideoProvider) (VideoBackend, error) {
+	spec, ok := LookupVideoBackend(provider)
+	if !ok {
+		return nil, fmt.Errorf("unknown video provider: %s (available: %s)", provider, videoProviderNames())
+	}
+	if err := spec.CheckConfig(); err != nil {
+		return nil, err
+	}
+	return spec.New(ctx)
+}
+
+// remoteCancelTimeout bounds the request that cancels a provider's job
+// once the caller's context is done.
+const remoteCancelTimeout = 30 * time.Second
+
+// cancelRemote stops a job the provider would otherwise keep running, and
+// billing, after the caller gave up on it.
+func cancelRemote(ctx context.Context, job string, cancel func(ctx context.Context) error) {
+	ctx, done := context.WithTimeout(context.WithoutCancel(ctx), remoteCancelTimeout)
+	defer done()
+
+	if err := cancel(ctx); err != nil {
+		fmt.Printf("Failed to cancel %s: %v\n", job, err)
+		return
+	}
+	fmt.Printf("Cancelled %s\n", job)
+}
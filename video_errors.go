@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/replicate/replicate-go"
+)
+
+// Video provider failures are tagged with one of these so the failover
+// policy can decide what to do whichever backend produced them.
+var (
+	ErrVideoAuth          = errors.New("video provider authentication failed")
+	ErrVideoNotAllowed    = errors.New("video provider access not allowed")
+	ErrVideoQuotaExceeded = errors.New("video provider quota or credit exhausted")
+	ErrVideoRateLimited   = errors.New("video provider rate limited")
+	ErrVideoUnavailable   = errors.New("video provider unavailable")
+	// ErrVideoFiltered means the provider's safety filters removed the
+	// generated video.
+	ErrVideoFiltered = errors.New("video removed by provider safety filters")
+)
+
+// VideoHTTPError is a non-2xx reply from a provider's REST API.
+type VideoHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *VideoHTTPError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// classifyVideoError wraps err with the sentinel for its cause. Errors
+// that match none of them are returned unchanged.
+func classifyVideoError(err error) error {
+	kind := videoErrorKind(err)
+	if kind == nil || errors.Is(err, kind) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// isTransientVideoError reports whether a request that failed with err may
+// succeed if it is retried.
+func isTransientVideoError(err error) bool {
+	kind := videoErrorKind(err)
+	return kind == ErrVideoUnavailable || kind == ErrVideoRateLimited
+}
+
+func videoErrorKind(err error) error {
+	var httpErr *VideoHTTPError
+	if errors.As(err, &httpErr) {
+		// Google answers 403 when the project is not on a model's
+		// allowlist and 404 for publisher models it cannot see.
+		if httpErr.StatusCode == http.StatusNotFound && strings.Contains(httpErr.Body, "model") {
+			return ErrVideoNotAllowed
+		}
+		if httpErr.StatusCode == http.StatusBadRequest && strings.Contains(httpErr.Body, "API_KEY_INVALID") {
+			return ErrVideoAuth
+		}
+		return videoErrorKindForStatus(httpErr.StatusCode)
+	}
+
+	var apiErr *replicate.APIError
+	if errors.As(err, &apiErr) {
+		return videoErrorKindForStatus(apiErr.Status)
+	}
+
+	var modelErr *replicate.ModelError
+	if errors.As(err, &modelErr) && modelErr.Prediction != nil {
+		// E005 is Replicate's code for inputs or outputs flagged as sensitive.
+		if message := fmt.Sprint(modelErr.Prediction.Error); strings.Contains(message, "E005") || strings.Contains(message, "flagged as sensitive") {
+			return ErrVideoFiltered
+		}
+		return nil
+	}
+
+	// The caller's own cancellation is handled before classification, so
+	// a deadline here is a provider that took too long.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrVideoUnavailable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrVideoUnavailable
+	}
+
+	return nil
+}
+
+func videoErrorKindForStatus(status int) error {
+	switch {
+	case status == http.StatusUnauthorized:
+		return ErrVideoAuth
+	case status == http.StatusForbidden:
+		return ErrVideoNotAllowed
+	case status == http.StatusPaymentRequired:
+		return ErrVideoQuotaExceeded
+	case status == http.StatusTooManyRequests:
+		return ErrVideoRateLimited
+	case status >= 500:
+		return ErrVideoUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// VideoFailoverPolicy is the ordered list of providers a prompt is tried
+// on and the error classes that move it to the next one. Errors of any
+// other class are fatal for that prompt.
+type VideoFailoverPolicy struct {
+	Chain      []VideoProvider
+	FailoverOn []string
+}
+
+// videoErrorClasses names the error classes VIDEO_FAILOVER_ON accepts.
+// Errors that match none of them are "unknown".
+var videoErrorClasses = []struct {
+	Name string
+	Err  error
+}{
+	{"auth", ErrVideoAuth},
+	{"not_allowed", ErrVideoNotAllowed},
+	{"quota", ErrVideoQuotaExceeded},
+	{"rate_limited", ErrVideoRateLimited},
+	{"unavailable", ErrVideoUnavailable},
+	{"filtered", ErrVideoFiltered},
+}
+
+const unknownVideoErrorClass = "unknown"
+
+// Safety filter hits and unknown errors are fatal by default: another
+// provider is unlikely to accept a filtered prompt, and an unknown error
+// may have been billed already.
+var defaultVideoFailoverOn = []string{"auth", "not_allowed", "quota", "rate_limited", "unavailable"}
+
+func NewVideoFailoverPolicyFromEnv() (VideoFailoverPolicy, error) {
+	policy := VideoFailoverPolicy{
+		Chain:      []VideoProvider{VideoProvider(getEnvWithDefault("VIDEO_PROVIDER", "veo2"))},
+		FailoverOn: defaultVideoFailoverOn,
+	}
+
+	if value := os.Getenv("VIDEO_FAILOVER_CHAIN"); value != "" {
+		policy.Chain = nil
+		seen := make(map[VideoProvider]bool)
+		for _, name := range splitList(value) {
+			provider := VideoProvider(name)
+			if _, ok := LookupVideoBackend(provider); !ok {
+				return policy, fmt.Errorf("VIDEO_FAILOVER_CHAIN has unknown provider %q (available: %s)", name, videoProviderNames())
+			}
+			if seen[provider] {
+				return policy, fmt.Errorf("VIDEO_FAILOVER_CHAIN lists %s twice", name)
+			}
+			seen[provider] = true
+			policy.Chain = append(policy.Chain, provider)
+		}
+		if len(policy.Chain) == 0 {
+			return policy, fmt.Errorf("VIDEO_FAILOVER_CHAIN must list at least one provider")
+		}
+	}
+
+	if value, ok := os.LookupEnv("VIDEO_FAILOVER_ON"); ok {
+		policy.FailoverOn = splitList(value)
+		for _, class := range policy.FailoverOn {
+			if !isVideoErrorClass(class) {
+				return policy, fmt.Errorf("VIDEO_FAILOVER_ON has unknown error class %q (available: %s)", class, strings.Join(videoErrorClassNames(), ", "))
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// String lists the chain in failover order.
+func (p VideoFailoverPolicy) String() string {
+	names := make([]string, 0, len(p.Chain))
+	for _, provider := range p.Chain {
+		names = append(names, string(provider))
+	}
+	return strings.Join(names, " → ")
+}
+
+// PrivateURLProviders returns the providers in the chain whose video URLs
+// Instagram cannot fetch, so their videos can only be posted from an asset
+// store with a public URL.
+func (p VideoFailoverPolicy) PrivateURLProviders() []VideoProvider {
+	var providers []VideoProvider
+	for _, provider := range p.Chain {
+		if spec, ok := LookupVideoBackend(provider); ok && spec.PrivateURLs {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// videoErrorClass returns the name of the class err belongs to.
+func videoErrorClass(err error) string {
+	for _, class := range videoErrorClasses {
+		if errors.Is(err, class.Err) {
+			return class.Name
+		}
+	}
+	return unknownVideoErrorClass
+}
+
+func videoErrorClassNames() []string {
+	names := make([]string, 0, len(videoErrorClasses)+1)
+	for _, class := range videoErrorClasses {
+		names = append(names, class.Name)
+	}
+	return append(names, unknownVideoErrorClass)
+}
+
+func isVideoErrorClass(name string) bool {
+	for _, class := range videoErrorClassNames() {
+		if class == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ShouldFailover reports whether a classified error moves the prompt to
+// the next provider in the chain.
+func (p VideoFailoverPolicy) ShouldFailover(err error) bool {
+	class := videoErrorClass(err)
+	for _, failoverClass := range p.FailoverOn {
+		if failoverClass == class {
+			return true
+		}
+	}
+	return false
+}
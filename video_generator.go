@@ -1,284 +1,690 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/generative-ai-go/genai"
 	"github.com/google/uuid"
-	"github.com/replicate/replicate-go"
-	"google.golang.org/api/option"
 )
 
+// VideoGenerator runs prompts through the registered VideoBackends of a
+// failover chain and applies the checks every provider shares.
 type VideoGenerator struct {
-	geminiClient    *genai.Client
-	replicateClient *replicate.Client
-	vertexAPIKey    string
-	projectID       string
-	provider        VideoProvider
+	backends  []VideoBackend
+	limiters  map[VideoProvider]*videoProviderLimiter
+	policy    VideoFailoverPolicy
+	budget    *Budget
+	jobs      *VideoJobQueue
+	webhooks  *ReplicateWebhookServer
+	assets    *AssetStore
+	batch     VideoBatchConfig
+	listeners []func(VideoProgress)
+	mu        sync.Mutex
+	// chainMu guards backends, limiters and policy, which SetProvider
+	// replaces while batches may be running.
+	chainMu sync.RWMutex
 }
 
-func NewVideoGenerator(geminiAPIKey, replicateAPIKey, vertexAPIKey, projectID string, provider VideoProvider) (*VideoGenerator, error) {
-	vg := &VideoGenerator{
-		vertexAPIKey: vertexAPIKey,
-		projectID:    projectID,
-		provider:     provider,
-	}
+type VideoBatchConfig struct {
+	Workers int
+}
 
-	// Only initialize the client we need based on provider
-	switch provider {
-	case Veo2:
-		if geminiAPIKey == "" {
-			return nil, fmt.Errorf("GEMINI_API_KEY is required for veo2 provider")
-		}
-		ctx := context.Background()
-		geminiClient, err := genai.NewClient(ctx, option.WithAPIKey(geminiAPIKey))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Gemini client: %w", err)
-		}
-		vg.geminiClient = geminiClient
+type VideoStage string
+
+const (
+	VideoQueued VideoStage = "queued"
+	// VideoWaiting means the prompt is waiting for a free slot or the rate
+	// limit of Provider.
+	VideoWaiting    VideoStage = "waiting"
+	VideoGenerating VideoStage = "generating"
+	// VideoFailedOver means Provider failed or was over budget and the
+	// next provider in the chain is tried.
+	VideoFailedOver VideoStage = "failed_over"
+	VideoSucceeded  VideoStage = "succeeded"
+	VideoFailed     VideoStage = "failed"
+)
 
-	case Veo3Replicate:
-		if replicateAPIKey == "" {
-			return nil, fmt.Errorf("REPLICATE_API_KEY is required for veo3-replicate provider")
-		}
-		replicateClient, err := replicate.NewClient(replicate.WithToken(replicateAPIKey))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Replicate client: %w", err)
-		}
-		vg.replicateClient = replicateClient
+// VideoProgress is emitted every time a prompt changes stage. Index is the
+// prompt's position in GenerateBatch and zero for GenerateVideo.
+type VideoProgress struct {
+	Index    int
+	PromptID string
+	Provider VideoProvider
+	Stage    VideoStage
+	Err      error
+	Time     time.Time
+}
 
-	case Veo3Vertex:
-		if vertexAPIKey == "" || projectID == "" {
-			return nil, fmt.Errorf("VERTEX_API_KEY and GOOGLE_PROJECT_ID are required for veo3-vertex provider")
-		}
-		// No client initialization needed for Vertex AI (uses HTTP directly)
+type VideoResult struct {
+	Index  int
+	Prompt *VideoPrompt
+	Video  *GeneratedVideo
+	Err    error
+}
 
-	default:
-		return nil, fmt.Errorf("unknown video provider: %s", provider)
+func NewVideoGenerator(ctx context.Context, policy VideoFailoverPolicy) (*VideoGenerator, error) {
+	if len(policy.Chain) == 0 {
+		return nil, fmt.Errorf("no video provider configured")
 	}
 
+	vg := &VideoGenerator{
+		limiters: make(map[VideoProvider]*videoProviderLimiter),
+		policy:   policy,
+		batch:    DefaultVideoBatchConfig(),
+	}
+	for _, provider := range policy.Chain {
+		if err := vg.addBackend(ctx, provider); err != nil {
+			return nil, err
+		}
+	}
 	return vg, nil
 }
 
-func (vg *VideoGenerator) GenerateVideo(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
-	fmt.Printf("Generating video with %s for prompt: %s\n", vg.provider, prompt.Text)
+func DefaultVideoBatchConfig() VideoBatchConfig {
+	return VideoBatchConfig{Workers: 4}
+}
 
-	switch vg.provider {
-	case Veo3Replicate:
-		return vg.generateWithVeo3Replicate(ctx, prompt)
-	case Veo3Vertex:
-		return vg.generateWithVeo3Vertex(ctx, prompt)
-	default:
-		return vg.generateWithVeo2(ctx, prompt)
+func NewVideoBatchConfigFromEnv() (VideoBatchConfig, error) {
+	config := DefaultVideoBatchConfig()
+
+	if value := os.Getenv("VIDEO_WORKERS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers <= 0 {
+			return config, fmt.Errorf("VIDEO_WORKERS must be a positive integer, got %q", value)
+		}
+		config.Workers = workers
 	}
+
+	return config, nil
+}
+
+// SetBatchConfig sets how many prompts GenerateBatch works on at once.
+// Each provider's own limits still apply on top.
+func (vg *VideoGenerator) SetBatchConfig(config VideoBatchConfig) {
+	vg.batch = config
 }
 
-func (vg *VideoGenerator) generateWithVeo2(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
-	model := vg.geminiClient.GenerativeModel("veo-2.0-generate-001")
-	
-	// Note: This is a placeholder implementation as the actual Gemini video API
-	// might have different method signatures in the Go client
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt.Text))
+func (vg *VideoGenerator) addBackend(ctx context.Context, provider VideoProvider) error {
+	backend, err := NewVideoBackend(ctx, provider)
+	if err != nil {
+		return err
+	}
+	spec, _ := LookupVideoBackend(provider)
+	limits, err := spec.LimitsFromEnv()
 	if err != nil {
-		return nil, fmt.Errorf("Veo 2 generation failed: %w", err)
+		return err
 	}
 
-	// Extract video URL from response (placeholder logic)
-	videoURL := "https://placeholder-video.com/veo2/" + prompt.ID + ".mp4"
-	if resp.Candidates != nil && len(resp.Candidates) > 0 {
-		// Extract actual video URL from response when available
+	if receiver, ok := backend.(replicateWebhookReceiver); ok && vg.webhooks != nil {
+		receiver.SetWebhooks(vg.webhooks)
 	}
 
-	return &GeneratedVideo{
-		ID:        uuid.New().String(),
-		PromptID:  prompt.ID,
-		VideoURL:  videoURL,
-		Duration:  5,
-		CreatedAt: time.Now(),
-	}, nil
+	vg.backends = append(vg.backends, backend)
+	vg.limiters[provider] = newVideoProviderLimiter(limits)
+	return nil
+}
+
+// chain returns the current failover chain. SetProvider swaps in a new
+// chain rather than changing this one, so callers can use it unlocked.
+func (vg *VideoGenerator) chain() ([]VideoBackend, map[VideoProvider]*videoProviderLimiter, VideoFailoverPolicy) {
+	vg.chainMu.RLock()
+	defer vg.chainMu.RUnlock()
+	return vg.backends, vg.limiters, vg.policy
+}
+
+// Provider returns the primary provider, the first in the chain.
+func (vg *VideoGenerator) Provider() VideoProvider {
+	backends, _, _ := vg.chain()
+	return backends[0].Name()
+}
+
+func (vg *VideoGenerator) Capabilities() VideoCapabilities {
+	backends, _, _ := vg.chain()
+	return backends[0].Capabilities()
+}
+
+// SetBudget prices every generation against the budget of the prompt's
+// account. Providers that would go over budget are skipped, or the video is
+// refused if the account's group says so.
+func (vg *VideoGenerator) SetBudget(budget *Budget) {
+	vg.budget = budget
+}
+
+// SetJobQueue records every prompt as a durable job. Jobs that are still
+// unfinished when the process dies are picked up by ResumeJobs.
+func (vg *VideoGenerator) SetJobQueue(jobs *VideoJobQueue) {
+	vg.jobs = jobs
 }
 
-func (vg *VideoGenerator) generateWithVeo3Replicate(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
-	input := replicate.PredictionInput{
-		"prompt":          prompt.Text,
-		"enhance_prompt":  true,
-		"negative_prompt": "low quality, blurry, distorted",
+// SetAssetStore downloads every finished video into the store before its
+// provider URL expires.
+func (vg *VideoGenerator) SetAssetStore(assets *AssetStore) {
+	vg.assets = assets
+}
+
+type replicateWebhookReceiver interface {
+	SetWebhooks(webhooks *ReplicateWebhookServer)
+}
+
+// SetReplicateWebhooks has Replicate report finished predictions to the
+// webhook server instead of being polled every second. Each prediction is
+// still awaited by its batch worker, which holds the provider's
+// concurrency slot until the render finishes.
+func (vg *VideoGenerator) SetReplicateWebhooks(webhooks *ReplicateWebhookServer) {
+	vg.webhooks = webhooks
+	backends, _, _ := vg.chain()
+	for _, backend := range backends {
+		if receiver, ok := backend.(replicateWebhookReceiver); ok {
+			receiver.SetWebhooks(webhooks)
+		}
 	}
+}
+
+// OnProgress registers a callback for every stage change. Callbacks run on
+// the generating goroutine, one event at a time, so they should return
+// quickly.
+func (vg *VideoGenerator) OnProgress(listener func(VideoProgress)) {
+	vg.mu.Lock()
+	defer vg.mu.Unlock()
+	vg.listeners = append(vg.listeners, listener)
+}
 
-	webhook := replicate.Webhook{
-		URL:    "",
-		Events: []replicate.WebhookEventType{"completed"},
+func (vg *VideoGenerator) emit(progress VideoProgress) {
+	progress.Time = time.Now()
+
+	vg.mu.Lock()
+	defer vg.mu.Unlock()
+	for _, listener := range vg.listeners {
+		listener(progress)
 	}
+}
 
-	prediction, err := vg.replicateClient.CreatePrediction(ctx, "google/veo-3", input, &webhook, false)
-	if err != nil {
-		return nil, fmt.Errorf("Veo 3 Replicate generation failed: %w", err)
+func (vg *VideoGenerator) GenerateVideo(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
+	return vg.generate(ctx, 0, prompt)
+}
+
+func (vg *VideoGenerator) generate(ctx context.Context, index int, prompt *VideoPrompt) (*GeneratedVideo, error) {
+	var job *VideoJob
+	if vg.jobs != nil {
+		var err error
+		if job, err = vg.jobs.Enqueue(prompt); err != nil {
+			vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Stage: VideoFailed, Err: err})
+			return nil, err
+		}
 	}
+	return vg.finish(ctx, index, prompt, job, func() (*GeneratedVideo, error) {
+		return vg.generateVideo(ctx, index, prompt, job)
+	})
+}
 
-	// Wait for completion
-	err = vg.replicateClient.Wait(ctx, prediction)
+// finish runs work and records its outcome on the job and as progress.
+func (vg *VideoGenerator) finish(ctx context.Context, index int, prompt *VideoPrompt, job *VideoJob, work func() (*GeneratedVideo, error)) (*GeneratedVideo, error) {
+	video, err := work()
 	if err != nil {
-		return nil, fmt.Errorf("Veo 3 Replicate wait failed: %w", err)
+		vg.updateJob(job, func(job *VideoJob) {
+			job.State = JobFailed
+			if ctx.Err() != nil {
+				job.State = JobCancelled
+			}
+			job.Error = err.Error()
+		})
+		vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Stage: VideoFailed, Err: err})
+		return nil, err
 	}
 
-	videoURL, ok := prediction.Output.(string)
-	if !ok {
-		return nil, fmt.Errorf("unexpected output format from Veo 3 Replicate")
-	}
+	vg.updateJob(job, func(job *VideoJob) {
+		job.State = JobSucceeded
+		job.Video = video
+		job.Error = ""
+	})
+	vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Provider: video.Provider, Stage: VideoSucceeded})
+	return video, nil
+}
 
-	return &GeneratedVideo{
-		ID:        uuid.New().String(),
-		PromptID:  prompt.ID,
-		VideoURL:  videoURL,
-		Duration:  8,
-		CreatedAt: time.Now(),
-	}, nil
+// collect stores and inspects a finished video, so it is priced by its
+// real duration. The video is paid for, so a failed download only loses
+// the copy or the metadata.
+func (vg *VideoGenerator) collect(ctx context.Context, video *GeneratedVideo) {
+	if err := vg.storeAsset(ctx, video); err != nil {
+		fmt.Printf("Failed to store video %s: %v\n", video.ID, err)
+	}
+	if err := vg.inspect(ctx, video); err != nil {
+		fmt.Printf("Failed to inspect video %s: %v\n", video.ID, err)
+	}
 }
 
-func (vg *VideoGenerator) generateWithVeo3Vertex(ctx context.Context, prompt *VideoPrompt) (*GeneratedVideo, error) {
-	endpoint := fmt.Sprintf("https://aiplatform.googleapis.com/v1/projects/%s/locations/us-central1/publishers/google/models/veo-3.0-generate-preview:predictLongRunning", vg.projectID)
+func (vg *VideoGenerator) storeAsset(ctx context.Context, video *GeneratedVideo) error {
+	if vg.assets == nil {
+		return nil
+	}
+	return vg.assets.Ingest(ctx, video, func(ctx context.Context) (io.ReadCloser, error) {
+		return vg.fetch(ctx, video)
+	})
+}
 
-	requestBody := map[string]interface{}{
-		"instances": []map[string]interface{}{
-			{"prompt": prompt.Text},
-		},
-		"parameters": map[string]interface{}{
-			"aspectRatio":     "9:16",
-			"durationSeconds": 8,
-			"numberOfVideos":  1,
-		},
+// fetch downloads a video from its provider.
+func (vg *VideoGenerator) fetch(ctx context.Context, video *GeneratedVideo) (io.ReadCloser, error) {
+	backends, _, _ := vg.chain()
+	for _, backend := range backends {
+		if fetcher, ok := backend.(VideoFetcher); ok && backend.Name() == video.Provider {
+			return fetcher.Fetch(ctx, video)
+		}
 	}
+	return downloadVideo(ctx, video.VideoURL)
+}
 
-	jsonBody, err := json.Marshal(requestBody)
+// inspect reads the video's real duration, format and codecs, from the
+// stored copy when there is one.
+func (vg *VideoGenerator) inspect(ctx context.Context, video *GeneratedVideo) error {
+	var body io.ReadCloser
+	var err error
+	switch {
+	case video.AssetSHA256 != "" && vg.assets != nil:
+		body, err = vg.assets.Open(ctx, video.AssetSHA256)
+	case video.LocalPath != "":
+		body, err = os.Open(video.LocalPath)
+	default:
+		body, err = vg.fetch(ctx, video)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return err
 	}
+	defer body.Close()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonBody))
+	metadata, err := InspectMP4(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
+	video.Metadata = metadata
+	video.Duration = int(math.Round(metadata.DurationSeconds))
+	return nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+vg.vertexAPIKey)
-	req.Header.Set("Content-Type", "application/json")
+func (vg *VideoGenerator) updateJob(job *VideoJob, change func(job *VideoJob)) {
+	if job == nil {
+		return
+	}
+	if err := vg.jobs.Update(job, change); err != nil {
+		fmt.Printf("Failed to record video job state: %v\n", err)
+	}
+}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("Vertex AI request failed: %w", err)
+func (vg *VideoGenerator) generateVideo(ctx context.Context, index int, prompt *VideoPrompt, job *VideoJob) (*GeneratedVideo, error) {
+	if prompt.Moderation != nil && !prompt.Moderation.Approved {
+		return nil, fmt.Errorf("%w: %s", ErrPromptRejected, strings.Join(prompt.Moderation.Reasons, "; "))
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Vertex AI request failed with status %d: %s", resp.StatusCode, string(body))
+	backends, limiters, policy := vg.chain()
+	var failedOver, overBudget []VideoProvider
+	var errs []error
+	for i, backend := range backends {
+		reservation, err := vg.reserve(prompt, backend)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Name(), err))
+			if vg.budget.Refuses(prompt.AccountID) {
+				return nil, errors.Join(errs...)
+			}
+			fmt.Printf("%s is over budget, downgrading: %v\n", backend.Name(), err)
+			vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Provider: backend.Name(), Stage: VideoFailedOver, Err: err})
+			overBudget = append(overBudget, backend.Name())
+			vg.updateJob(job, func(job *VideoJob) {
+				job.OverBudget = overBudget
+			})
+			continue
+		}
+
+		video, remoteID, err := vg.generateWith(ctx, index, backend, limiters[backend.Name()], prompt, job)
+		if err == nil {
+			video.Provider = backend.Name()
+			video.AccountID = prompt.AccountID
+			video.FailedOver = failedOver
+			video.OverBudget = overBudget
+			video.Content = prompt.Content
+			vg.collect(ctx, video)
+			vg.commit(reservation, prompt, video)
+			return video, nil
+		}
+
+		// Once the provider has accepted the job it bills for it, and may
+		// still be rendering it, so it is not tried on the next provider
+		// unless it finished without a video.
+		if remoteID != "" {
+			vg.abandon(ctx, reservation, backend, prompt, remoteID, err)
+		} else {
+			reservation.Release()
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		err = fmt.Errorf("%s: %w", backend.Name(), classifyVideoError(err))
+		errs = append(errs, err)
+		if remoteID != "" && !errors.Is(err, ErrVideoFiltered) {
+			return nil, errors.Join(errs...)
+		}
+		if errors.Is(err, ErrVideoRateLimited) {
+			limiters[backend.Name()].bucket.PauseFor(videoRateLimitPause)
+		}
+		if !policy.ShouldFailover(err) {
+			return nil, errors.Join(errs...)
+		}
+		if i+1 < len(backends) {
+			fmt.Printf("%s failed (%s), failing over to %s: %v\n", backend.Name(), videoErrorClass(err), backends[i+1].Name(), err)
+			vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Provider: backend.Name(), Stage: VideoFailedOver, Err: err})
+		}
+		failedOver = append(failedOver, backend.Name())
+		vg.updateJob(job, func(job *VideoJob) {
+			job.State = JobQueued
+			job.Provider = ""
+			job.RemoteID = ""
+			job.FailedOver = failedOver
+		})
 	}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	return nil, fmt.Errorf("every video provider failed: %w", errors.Join(errs...))
+}
+
+// generateWith runs one backend once it has a free slot under its
+// concurrency and rate limits. It returns the remote ID of a resumable
+// backend's job once the provider has accepted it, even if the job then
+// fails. With a job queue, the remote ID is saved before waiting for the
+// result.
+func (vg *VideoGenerator) generateWith(ctx context.Context, index int, backend VideoBackend, limiter *videoProviderLimiter, prompt *VideoPrompt, job *VideoJob) (*GeneratedVideo, string, error) {
+	vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Provider: backend.Name(), Stage: VideoWaiting})
+	if err := limiter.Acquire(ctx); err != nil {
+		return nil, "", err
 	}
+	defer limiter.Release()
+
+	vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Provider: backend.Name(), Stage: VideoGenerating})
+	fmt.Printf("Generating video with %s for prompt: %s\n", backend.Name(), prompt.Text)
 
-	operationName, ok := result["name"].(string)
+	resumable, ok := backend.(ResumableVideoBackend)
 	if !ok {
-		return nil, fmt.Errorf("no operation name in response")
+		vg.updateJob(job, func(job *VideoJob) {
+			job.State = JobRunning
+			job.Provider = backend.Name()
+		})
+		video, err := backend.Generate(ctx, prompt)
+		return video, "", err
 	}
 
-	videoURL, err := vg.pollVertexOperation(ctx, operationName)
+	remoteID, err := resumable.Submit(ctx, prompt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to poll operation: %w", err)
+		return nil, "", err
 	}
+	vg.updateJob(job, func(job *VideoJob) {
+		job.State = JobSubmitted
+		job.Provider = backend.Name()
+		job.RemoteID = remoteID
+	})
+	video, err := resumable.Await(ctx, prompt, remoteID)
+	return video, remoteID, err
+}
 
-	return &GeneratedVideo{
-		ID:        uuid.New().String(),
-		PromptID:  prompt.ID,
-		VideoURL:  videoURL,
-		Duration:  8,
-		CreatedAt: time.Now(),
-	}, nil
+// abandon gives up on a job the provider accepted but that failed: it is
+// cancelled in case it is still rendering, and the reserved cost is
+// recorded, since the provider bills accepted jobs whether or not the video
+// arrives. Backends cancel their own jobs when ctx is done.
+func (vg *VideoGenerator) abandon(ctx context.Context, reservation *BudgetReservation, backend VideoBackend, prompt *VideoPrompt, remoteID string, err error) {
+	if canceller, ok := backend.(VideoCanceller); ok && ctx.Err() == nil && !errors.Is(classifyVideoError(err), ErrVideoFiltered) {
+		cancelRemote(ctx, fmt.Sprintf("%s job %s", backend.Name(), remoteID), func(ctx context.Context) error {
+			return canceller.Cancel(ctx, remoteID)
+		})
+	}
+
+	if vg.budget == nil {
+		return
+	}
+	seconds := backend.Capabilities().MaxDurationSeconds
+	vg.record(reservation, prompt, SpendEntry{
+		Kind:     SpendVideo,
+		Item:     string(backend.Name()),
+		PromptID: prompt.ID,
+		Seconds:  seconds,
+		Cost:     vg.budget.VideoCost(backend.Name(), seconds),
+	})
 }
 
-func (vg *VideoGenerator) pollVertexOperation(ctx context.Context, operationName string) (string, error) {
-	maxAttempts := 30
-	delay := 10 * time.Second
+// ResumeJobs finishes the jobs a previous process left behind: submitted
+// and running jobs are awaited by their remote ID instead of being paid for
+// again, queued ones are generated from the start of the chain. Results are
+// in the order the jobs were created. Jobs not started before ctx is done
+// stay in the queue.
+func (vg *VideoGenerator) ResumeJobs(ctx context.Context) ([]VideoResult, error) {
+	if vg.jobs == nil {
+		return nil, nil
+	}
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		default:
-		}
+	jobs := vg.jobs.Unfinished()
+	results := make([]VideoResult, len(jobs))
+	for i, job := range jobs {
+		results[i] = VideoResult{Index: i, Prompt: job.Prompt}
+	}
 
-		endpoint := fmt.Sprintf("https://aiplatform.googleapis.com/v1/%s", operationName)
-		req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	started := vg.runWorkers(ctx, len(jobs), func(i int) {
+		job := jobs[i]
+		work := func() (*GeneratedVideo, error) {
+			return vg.generateVideo(ctx, i, job.Prompt, job)
+		}
+		if job.RemoteID != "" {
+			work = func() (*GeneratedVideo, error) {
+				return vg.resumeJob(ctx, i, job)
+			}
+		}
+		video, err := vg.finish(ctx, i, job.Prompt, job, work)
 		if err != nil {
-			return "", fmt.Errorf("failed to create poll request: %w", err)
+			fmt.Printf("Failed to resume video job %s: %v\n", job.ID, err)
 		}
+		results[i].Video = video
+		results[i].Err = err
+	})
 
-		req.Header.Set("Authorization", "Bearer "+vg.vertexAPIKey)
+	for i := started; i < len(jobs); i++ {
+		results[i].Err = ctx.Err()
+	}
+	return results, ctx.Err()
+}
 
-		client := &http.Client{Timeout: 30 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			return "", fmt.Errorf("failed to poll operation: %w", err)
+func (vg *VideoGenerator) resumeJob(ctx context.Context, index int, job *VideoJob) (*GeneratedVideo, error) {
+	provider, prompt := job.Provider, job.Prompt
+	backend, limiter, err := vg.backendFor(ctx, provider)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resume job %s: %w", job.ID, err)
+	}
+	resumable, ok := backend.(ResumableVideoBackend)
+	if !ok {
+		return nil, fmt.Errorf("cannot resume job %s: %s jobs cannot be resumed", job.ID, provider)
+	}
+
+	vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Provider: provider, Stage: VideoWaiting})
+	if err := limiter.AcquireSlot(ctx); err != nil {
+		return nil, err
+	}
+	defer limiter.Release()
+
+	vg.emit(VideoProgress{Index: index, PromptID: prompt.ID, Provider: provider, Stage: VideoGenerating})
+	fmt.Printf("Resuming %s job %s for prompt: %s\n", provider, job.RemoteID, prompt.Text)
+
+	video, err := resumable.Await(ctx, prompt, job.RemoteID)
+	if err != nil {
+		vg.abandon(ctx, nil, backend, prompt, job.RemoteID, err)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
+		return nil, fmt.Errorf("%s: %w", provider, classifyVideoError(err))
+	}
+
+	video.Provider = provider
+	video.AccountID = prompt.AccountID
+	video.FailedOver = job.FailedOver
+	video.OverBudget = job.OverBudget
+	video.Content = prompt.Content
+	vg.collect(ctx, video)
+	vg.commit(nil, prompt, video)
+	return video, nil
+}
 
-		var operation map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&operation); err != nil {
-			resp.Body.Close()
-			return "", fmt.Errorf("failed to decode poll response: %w", err)
+// backendFor returns the chain's backend for provider, or a new one if the
+// chain changed since a job was submitted to it.
+func (vg *VideoGenerator) backendFor(ctx context.Context, provider VideoProvider) (VideoBackend, *videoProviderLimiter, error) {
+	backends, limiters, _ := vg.chain()
+	for _, backend := range backends {
+		if backend.Name() == provider {
+			return backend, limiters[provider], nil
 		}
-		resp.Body.Close()
+	}
 
-		if done, ok := operation["done"].(bool); ok && done {
-			if errorObj, exists := operation["error"]; exists {
-				return "", fmt.Errorf("operation failed: %v", errorObj)
-			}
+	standalone := &VideoGenerator{limiters: make(map[VideoProvider]*videoProviderLimiter), webhooks: vg.webhooks}
+	if err := standalone.addBackend(ctx, provider); err != nil {
+		return nil, nil, err
+	}
+	return standalone.backends[0], standalone.limiters[provider], nil
+}
 
-			if response, ok := operation["response"].(map[string]interface{}); ok {
-				if predictions, ok := response["predictions"].([]interface{}); ok && len(predictions) > 0 {
-					if prediction, ok := predictions[0].(map[string]interface{}); ok {
-						if videoURL, ok := prediction["videoUrl"].(string); ok {
-							return videoURL, nil
-						}
-					}
-				}
-			}
+// reserve holds the most a backend can charge for one video against the
+// prompt's budget.
+func (vg *VideoGenerator) reserve(prompt *VideoPrompt, backend VideoBackend) (*BudgetReservation, error) {
+	if vg.budget == nil {
+		return nil, nil
+	}
+	estimate := vg.budget.VideoCost(backend.Name(), backend.Capabilities().MaxDurationSeconds)
+	return vg.budget.Reserve(prompt.AccountID, estimate)
+}
 
-			return "", fmt.Errorf("no video URL in completed operation")
-		}
+func (vg *VideoGenerator) commit(reservation *BudgetReservation, prompt *VideoPrompt, video *GeneratedVideo) {
+	if vg.budget == nil {
+		return
+	}
+	video.Cost = vg.budget.VideoCost(video.Provider, video.Duration)
+	vg.record(reservation, prompt, SpendEntry{
+		Kind:     SpendVideo,
+		Item:     string(video.Provider),
+		PromptID: prompt.ID,
+		Seconds:  video.Duration,
+		Cost:     video.Cost,
+	})
+}
 
-		fmt.Printf("Video generation in progress... (attempt %d/%d)\n", attempt+1, maxAttempts)
-		time.Sleep(delay)
+// record commits entry against reservation. Resumed jobs were reserved by
+// the process that submitted them, so they are recorded without one.
+func (vg *VideoGenerator) record(reservation *BudgetReservation, prompt *VideoPrompt, entry SpendEntry) {
+	var err error
+	if reservation != nil {
+		err = reservation.Commit(entry)
+	} else {
+		err = vg.budget.Record(prompt.AccountID, entry)
+	}
+	if err != nil {
+		fmt.Printf("Failed to record video spend: %v\n", err)
 	}
+}
 
-	return "", fmt.Errorf("video generation timed out")
+func negativePrompt(prompt *VideoPrompt) string {
+	const base = "low quality, blurry, distorted"
+	if prompt.Content == nil || prompt.Content.NegativePrompt == "" {
+		return base
+	}
+	return base + ", " + prompt.Content.NegativePrompt
 }
 
-func (vg *VideoGenerator) GenerateBatch(ctx context.Context, prompts []*VideoPrompt) ([]*GeneratedVideo, error) {
-	videos := make([]*GeneratedVideo, 0, len(prompts))
-	
-	for _, prompt := range prompts {
-		video, err := vg.GenerateVideo(ctx, prompt)
+// GenerateBatch renders prompts concurrently on a bounded worker pool, with
+// each provider's concurrency and rate limits applied on top. Every prompt
+// gets a result in order. Cancelling ctx cancels the remote jobs that are
+// in flight and marks unstarted items with the context error.
+func (vg *VideoGenerator) GenerateBatch(ctx context.Context, prompts []*VideoPrompt) ([]VideoResult, error) {
+	results := make([]VideoResult, len(prompts))
+	for i, prompt := range prompts {
+		results[i] = VideoResult{Index: i, Prompt: prompt}
+		vg.emit(VideoProgress{Index: i, PromptID: prompt.ID, Stage: VideoQueued})
+	}
+
+	started := vg.runWorkers(ctx, len(prompts), func(i int) {
+		video, err := vg.generate(ctx, i, prompts[i])
 		if err != nil {
-			fmt.Printf("Failed to generate video for prompt %s: %v\n", prompt.ID, err)
-			continue
+			fmt.Printf("Failed to generate video for prompt %s: %v\n", prompts[i].ID, err)
 		}
-		videos = append(videos, video)
+		results[i].Video = video
+		results[i].Err = err
+	})
+
+	for i := started; i < len(prompts); i++ {
+		results[i].Err = ctx.Err()
+		vg.emit(VideoProgress{Index: i, PromptID: prompts[i].ID, Stage: VideoFailed, Err: ctx.Err()})
 	}
 
-	return videos, nil
+	return results, ctx.Err()
 }
 
-func (vg *VideoGenerator) SetProvider(provider VideoProvider) {
-	vg.provider = provider
+// runWorkers calls work for items 0 to count-1 on up to VIDEO_WORKERS
+// goroutines and returns how many items were started before ctx was done.
+func (vg *VideoGenerator) runWorkers(ctx context.Context, count int, work func(i int)) int {
+	workers := vg.batch.Workers
+	if workers > count {
+		workers = count
+	}
+
+	items := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				work(i)
+			}
+		}()
+	}
+
+	started := 0
+feed:
+	for ; started < count; started++ {
+		select {
+		case items <- started:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(items)
+	wg.Wait()
+	return started
+}
+
+func SuccessfulVideos(results []VideoResult) []*GeneratedVideo {
+	videos := make([]*GeneratedVideo, 0, len(results))
+	for _, result := range results {
+		if result.Err == nil && result.Video != nil {
+			videos = append(videos, result.Video)
+		}
+	}
+	return videos
+}
+
+// SetProvider replaces the failover chain with a single provider. Prompts
+// already generating finish on the chain they started with.
+func (vg *VideoGenerator) SetProvider(ctx context.Context, provider VideoProvider) error {
+	replacement := &VideoGenerator{limiters: make(map[VideoProvider]*videoProviderLimiter), webhooks: vg.webhooks}
+	if err := replacement.addBackend(ctx, provider); err != nil {
+		return err
+	}
+
+	vg.chainMu.Lock()
+	defer vg.chainMu.Unlock()
+	vg.backends = replacement.backends
+	vg.limiters = replacement.limiters
+	policy := vg.policy
+	policy.Chain = []VideoProvider{provider}
+	vg.policy = policy
 	fmt.Printf("Switched to %s for video generation\n", provider)
+	return nil
 }
 
 func (vg *VideoGenerator) TestGeneration(ctx context.Context, testPrompt string) (*GeneratedVideo, error) {
@@ -290,8 +696,9 @@ func (vg *VideoGenerator) TestGeneration(ctx context.Context, testPrompt string)
 		ID:        uuid.New().String(),
 		Text:      testPrompt,
 		Theme:     "test",
+		Source:    PromptSourceManual,
 		CreatedAt: time.Now(),
 	}
 
 	return vg.GenerateVideo(ctx, prompt)
-}
\ No newline at end of file
+}
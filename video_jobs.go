@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoJobState string
+
+const (
+	JobQueued VideoJobState = "queued"
+	// JobSubmitted means the provider accepted the job and its RemoteID is
+	// recorded, so the job can be resumed instead of paid for twice.
+	JobSubmitted VideoJobState = "submitted"
+	// JobRunning means a backend that cannot be resumed is generating the
+	// job. Resumable jobs stay submitted until they finish.
+	JobRunning   VideoJobState = "running"
+	JobSucceeded VideoJobState = "succeeded"
+	JobFailed    VideoJobState = "failed"
+	JobCancelled VideoJobState = "cancelled"
+)
+
+// VideoJob is one prompt's way through the failover chain. Provider and
+// RemoteID name the attempt in flight: the Gemini or Vertex AI operation
+// name, or the Replicate prediction ID.
+type VideoJob struct {
+	ID         string          `json:"id"`
+	State      VideoJobState   `json:"state"`
+	Prompt     *VideoPrompt    `json:"prompt"`
+	Provider   VideoProvider   `json:"provider,omitempty"`
+	RemoteID   string          `json:"remote_id,omitempty"`
+	FailedOver []VideoProvider `json:"failed_over,omitempty"`
+	OverBudget []VideoProvider `json:"over_budget,omitempty"`
+	Video      *GeneratedVideo `json:"video,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+func (job *VideoJob) Finished() bool {
+	return job.State == JobSucceeded || job.State == JobFailed || job.State == JobCancelled
+}
+
+// VideoJobQueue keeps every video job as its own JSON file, rewritten
+// atomically on each state change, so a crash loses at most the change in
+// progress.
+type VideoJobQueue struct {
+	dir  string
+	jobs map[string]*VideoJob
+	mu   sync.Mutex
+}
+
+func OpenVideoJobQueue(dir string) (*VideoJobQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create video job directory: %w", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list video jobs: %w", err)
+	}
+
+	q := &VideoJobQueue{dir: dir, jobs: make(map[string]*VideoJob)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read video job: %w", err)
+		}
+		var job VideoJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode video job %s: %w", path, err)
+		}
+		if job.Prompt == nil {
+			return nil, fmt.Errorf("video job %s has no prompt", path)
+		}
+		q.jobs[job.ID] = &job
+	}
+	return q, nil
+}
+
+func (q *VideoJobQueue) Enqueue(prompt *VideoPrompt) (*VideoJob, error) {
+	now := time.Now()
+	job := &VideoJob{
+		ID:        uuid.New().String(),
+		State:     JobQueued,
+		Prompt:    prompt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := q.write(job); err != nil {
+		return nil, err
+	}
+	q.jobs[job.ID] = job
+	return job, nil
+}
+
+// Update applies change to the job and persists it.
+func (q *VideoJobQueue) Update(job *VideoJob, change func(job *VideoJob)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	change(job)
+	job.UpdatedAt = time.Now()
+	return q.write(job)
+}
+
+func (q *VideoJobQueue) write(job *VideoJob) error {
+	if err := writeJSONFile(filepath.Join(q.dir, job.ID+".json"), job); err != nil {
+		return fmt.Errorf("failed to save video job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Get returns a copy of the job.
+func (q *VideoJobQueue) Get(id string) (VideoJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return VideoJob{}, false
+	}
+	return *job, true
+}
+
+// Unfinished returns the jobs a previous process left queued, submitted or
+// running, oldest first.
+func (q *VideoJobQueue) Unfinished() []*VideoJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var jobs []*VideoJob
+	for _, job := range q.jobs {
+		if !job.Finished() {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Counts returns how many jobs are in each state.
+func (q *VideoJobQueue) Counts() map[VideoJobState]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counts := make(map[VideoJobState]int)
+	for _, job := range q.jobs {
+		counts[job.State]++
+	}
+	return counts
+}
+
+// Assets returns the asset hashes of every job's video.
+func (q *VideoJobQueue) Assets() map[string]bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	assets := make(map[string]bool)
+	for _, job := range q.jobs {
+		if job.Video != nil && job.Video.AssetSHA256 != "" {
+			assets[job.Video.AssetSHA256] = true
+		}
+	}
+	return assets
+}
+
+func formatJobCounts(counts map[VideoJobState]int) string {
+	var parts []string
+	for _, state := range []VideoJobState{JobQueued, JobSubmitted, JobRunning, JobSucceeded, JobFailed, JobCancelled} {
+		if counts[state] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+	if len(parts) == 0 {
+		return "no jobs"
+	}
+	return strings.Join(parts, ", ")
+}
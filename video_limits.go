@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VideoLimits bound how hard a provider is driven: how many generations
+// are in flight at once and how often new ones are submitted.
+type VideoLimits struct {
+	Concurrency int
+	// RequestsPerMinute caps submissions; zero means no rate limit.
+	RequestsPerMinute float64
+}
+
+// videoRateLimitPause is how long a provider gets no new submissions after
+// it answers rate limited. Video APIs do not send Retry-After.
+const videoRateLimitPause = 30 * time.Second
+
+func videoEnvPrefix(provider VideoProvider) string {
+	return strings.ToUpper(strings.ReplaceAll(string(provider), "-", "_"))
+}
+
+// LimitsFromEnv returns the backend's default limits overridden by
+// <PROVIDER>_CONCURRENCY and <PROVIDER>_REQUESTS_PER_MINUTE, e.g.
+// VEO3_VERTEX_CONCURRENCY.
+func (spec VideoBackendSpec) LimitsFromEnv() (VideoLimits, error) {
+	limits := spec.Limits
+	if limits.Concurrency < 1 {
+		limits.Concurrency = 1
+	}
+	prefix := videoEnvPrefix(spec.Provider)
+
+	if value := os.Getenv(prefix + "_CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err != nil || concurrency <= 0 {
+			return limits, fmt.Errorf("%s_CONCURRENCY must be a positive integer, got %q", prefix, value)
+		}
+		limits.Concurrency = concurrency
+	}
+
+	if value := os.Getenv(prefix + "_REQUESTS_PER_MINUTE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return limits, fmt.Errorf("%s_REQUESTS_PER_MINUTE must be a positive number, got %q", prefix, value)
+		}
+		limits.RequestsPerMinute = rate
+	}
+
+	return limits, nil
+}
+
+// videoProviderLimiter holds one provider's concurrency slots and
+// submission rate, shared by every prompt generated through it.
+type videoProviderLimiter struct {
+	slots  chan struct{}
+	bucket *tokenBucket
+}
+
+func newVideoProviderLimiter(limits VideoLimits) *videoProviderLimiter {
+	return &videoProviderLimiter{
+		slots:  make(chan struct{}, limits.Concurrency),
+		bucket: newTokenBucket(limits.RequestsPerMinute/60, 1),
+	}
+}
+
+// Acquire waits for a free slot and then for the rate limit. Every
+// successful Acquire must be paired with a Release.
+func (l *videoProviderLimiter) Acquire(ctx context.Context) error {
+	if err := l.AcquireSlot(ctx); err != nil {
+		return err
+	}
+	if err := l.bucket.Wait(ctx); err != nil {
+		<-l.slots
+		return err
+	}
+	return nil
+}
+
+// AcquireSlot waits for a free slot only, for jobs that were submitted
+// already.
+func (l *videoProviderLimiter) AcquireSlot(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *videoProviderLimiter) Release() {
+	<-l.slots
+}